@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// isAdmin reports whether the request carries the admin bearer token.
+// Admin access is disabled entirely when ADMIN_TOKEN is not set.
+func isAdmin(r *http.Request) bool {
+	if cfg.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+}
+
+// requireAdmin writes a 401 and returns false unless the request is from an admin.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !isAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, "Admin authorization required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
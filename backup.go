@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+	"gorm.io/gorm"
+)
+
+// backupBatchSize is how many books are held in memory at a time while a
+// backup is being written.
+const backupBatchSize = 500
+
+// maxConcurrentBackups caps simultaneous backups. Each holds a database
+// connection for as long as its archive takes to build, so they are limited
+// here rather than by -db-max-concurrent, whose slots are meant to turn over
+// quickly.
+const maxConcurrentBackups = 2
+
+var backupSlots = semaphore.NewWeighted(maxConcurrentBackups)
+
+// backupCSVColumns is the CSV layout, the same one /books/import reads, so a
+// backup can be re-imported as is.
+var backupCSVColumns = []string{"book_name", "author", "price", "genre", "currency", "language", "isbn", "stock"}
+
+type backupManifest struct {
+	// AsOf is when the newest change in the backup was made. It stands in
+	// for the creation time so that the same data always gives the same
+	// archive.
+	AsOf  time.Time      `json:"as_of"`
+	Files map[string]int `json:"files"`
+}
+
+// GetBackup serves GET /books/backup.zip: a ZIP holding books.json (the full
+// records, always with snake_case keys whatever -json-naming says),
+// books.csv (in the import format) and manifest.json with the row counts.
+// Accepts the list filters. Admin-only.
+//
+// Both files are read in one SNAPSHOT transaction (on by default in Azure
+// SQL Database), so they hold the same rows even while writes land. The
+// archive is built in batches into a temporary file, then the database is
+// let go and the file is served with http.ServeContent, so a failure is
+// always a plain 500 and interrupted downloads can resume: the archive is
+// byte-for-byte the same until the matched books change, and its strong
+// ETag (If-Range ignores weak ones) is derived from their version and the
+// filters. A client sends `If-Range: <etag>` with `Range: bytes=N-` and gets
+// the rest of the same archive, or all of the new one if the data changed.
+// Each request rebuilds the archive, resumed ones included.
+func GetBackup(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if inBatch(r) {
+		http.Error(w, "Backups cannot run inside /batch", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.DBQueueTimeout)
+	err = backupSlots.Acquire(ctx, 1)
+	cancel()
+	if err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many backups in progress, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	released := false
+	release := func() {
+		if !released {
+			backupSlots.Release(1)
+			released = true
+		}
+	}
+	defer release()
+
+	var (
+		tx      *gorm.DB
+		version collectionVersion
+	)
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		tx = db.Begin(&sql.TxOptions{Isolation: sql.LevelSnapshot})
+		if tx.Error != nil {
+			return tx.Error
+		}
+		var err error
+		if version, err = loadCollectionVersion(tx, bq); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback() // read-only; nothing to commit
+
+	etag := backupETag(version, bq)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	f, err := os.CreateTemp("", "books-backup-*.zip")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	asOf := version.lastModified().UTC()
+	if err := writeBackup(f, tx, bq, asOf); err != nil {
+		log.Printf("backup: %v", err)
+		http.Error(w, "Failed to build the backup", http.StatusInternalServerError)
+		return
+	}
+	tx.Rollback()
+	release()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="books-`+asOf.Format("20060102T150405Z")+`.zip"`)
+	http.ServeContent(w, r, "", asOf, f)
+}
+
+// backupETag is the strong entity tag of the backup of the books bq matches.
+func backupETag(v collectionVersion, bq BookQuery) string {
+	h := fnv.New32a()
+	h.Write([]byte(bq.Key()))
+	return fmt.Sprintf(`"backup-%d-%d-%d-%08x"`, v.Active, v.Total, v.lastModified().UnixNano(), h.Sum32())
+}
+
+// writeBackup writes the archive to out. Everything in it, timestamps
+// included, depends only on the rows, so the output is reproducible.
+func writeBackup(out io.Writer, tx *gorm.DB, bq BookQuery, asOf time.Time) error {
+	manifest := backupManifest{AsOf: asOf, Files: map[string]int{}}
+	zw := zip.NewWriter(out)
+	writers := []struct {
+		name  string
+		write func(io.Writer) (int, error)
+	}{
+		{"books.json", func(out io.Writer) (int, error) { return backupJSON(out, bq.Apply(tx)) }},
+		{"books.csv", func(out io.Writer) (int, error) { return backupCSV(out, bq.Apply(tx)) }},
+	}
+	for _, f := range writers {
+		out, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: asOf})
+		if err != nil {
+			return err
+		}
+		n, err := f.write(out)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", f.name, err)
+		}
+		manifest.Files[f.name] = n
+	}
+
+	mf, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: asOf})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func backupJSON(out io.Writer, db *gorm.DB) (int, error) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	if _, err := io.WriteString(out, "["); err != nil {
+		return 0, err
+	}
+	count := 0
+	var books []Book
+	err := db.FindInBatches(&books, backupBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, b := range books {
+			if count > 0 {
+				if _, err := io.WriteString(out, ","); err != nil {
+					return err
+				}
+			}
+			if err := enc.Encode(b); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return count, err
+	}
+	_, err = io.WriteString(out, "]\n")
+	return count, err
+}
+
+func backupCSV(out io.Writer, db *gorm.DB) (int, error) {
+	cw := csv.NewWriter(out)
+	if err := cw.Write(backupCSVColumns); err != nil {
+		return 0, err
+	}
+	count := 0
+	var books []Book
+	err := db.FindInBatches(&books, backupBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, b := range books {
+			price := ""
+			if b.Price != 0 {
+				price = formatPrice(b.Price)
+			}
+			stock := ""
+			if b.Stock != 0 {
+				stock = strconv.Itoa(b.Stock)
+			}
+			if err := cw.Write([]string{b.BookName, b.Author, price, b.Genre, b.Currency, b.Language, b.ISBN, stock}); err != nil {
+				return err
+			}
+			count++
+		}
+		cw.Flush()
+		return cw.Error()
+	}).Error
+	if err != nil {
+		return count, err
+	}
+	cw.Flush()
+	return count, cw.Error()
+}
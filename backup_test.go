@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupFailsBeforeStreaming(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	DB = dryRunDB(t)
+	cfg.AdminToken = "secret"
+	cfg.DBQueueTimeout = time.Second
+
+	req := httptest.NewRequest("GET", "/books/backup.zip", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	GetBackup(rec, req)
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Type") == "application/zip" {
+		t.Errorf("status %d, Content-Type %q; want a plain 500 when the first query fails",
+			rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestBackupsAreCappedSeparately(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	DB = dryRunDB(t)
+	cfg.AdminToken = "secret"
+	cfg.DBQueueTimeout = 10 * time.Millisecond
+	if err := backupSlots.Acquire(context.Background(), maxConcurrentBackups); err != nil {
+		t.Fatal(err)
+	}
+	defer backupSlots.Release(maxConcurrentBackups)
+
+	req := httptest.NewRequest("GET", "/books/backup.zip", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	GetBackup(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("status %d with every backup slot taken, want 503 with Retry-After", rec.Code)
+	}
+}
+
+func TestBackupSnapshotMatchesAcrossFiles(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.AdminToken = "secret"
+	cfg.DBQueueTimeout = time.Second
+	if err := db.Create(&[]Book{{BookName: "One"}, {BookName: "Two"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/books/backup.zip", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	GetBackup(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest backupManifest
+	for _, f := range zr.File {
+		if f.Name != "manifest.json" {
+			continue
+		}
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if manifest.Files["books.json"] != 2 || manifest.Files["books.csv"] != 2 {
+		t.Errorf("manifest files = %v, want 2 rows in each", manifest.Files)
+	}
+}
+
+func TestBackupETag(t *testing.T) {
+	withConfig(t)
+	parse := func(query string) BookQuery {
+		bq, err := ParseBookFilters(httptest.NewRequest("GET", "/books/backup.zip"+query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bq
+	}
+	v := collectionVersion{Active: 2, LastUpdated: sql.NullTime{Time: time.Unix(100, 0), Valid: true}}
+	etag := backupETag(v, parse(""))
+	if strings.HasPrefix(etag, "W/") {
+		t.Errorf("ETag %s is weak; If-Range needs a strong one", etag)
+	}
+	if backupETag(v, parse("")) != etag {
+		t.Error("ETag differs for the same version and filters")
+	}
+	if backupETag(v, parse("?author=x")) == etag {
+		t.Error("ETag ignores the filters")
+	}
+	v.Active = 3
+	if backupETag(v, parse("")) == etag {
+		t.Error("ETag ignores the version")
+	}
+	v.Active = 2
+	v.Total = 1
+	if backupETag(v, parse("")) == etag {
+		t.Error("ETag ignores purged rows")
+	}
+}
+
+func TestBackupResumesWithRange(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.AdminToken = "secret"
+	cfg.DBQueueTimeout = time.Second
+	if err := db.Create(&[]Book{{BookName: "One"}, {BookName: "Two"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	get := func(header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/books/backup.zip", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		GetBackup(rec, req)
+		return rec
+	}
+
+	full := get()
+	etag := full.Header().Get("ETag")
+	if full.Code != http.StatusOK || etag == "" {
+		t.Fatalf("full download: %d, ETag %q", full.Code, etag)
+	}
+	if again := get(); !bytes.Equal(again.Body.Bytes(), full.Body.Bytes()) {
+		t.Fatal("two backups of the same data differ")
+	}
+
+	rest := get("Range", "bytes=100-", "If-Range", etag)
+	if rest.Code != http.StatusPartialContent || !bytes.Equal(rest.Body.Bytes(), full.Body.Bytes()[100:]) {
+		t.Errorf("resumed download: %d with %d bytes, want 206 with the last %d bytes", rest.Code, rest.Body.Len(), full.Body.Len()-100)
+	}
+
+	if err := db.Create(&Book{BookName: "Three"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	stale := get("Range", "bytes=100-", "If-Range", etag)
+	if stale.Code != http.StatusOK || stale.Header().Get("ETag") == etag {
+		t.Errorf("resume after a change: %d with ETag %s, want the whole new archive", stale.Code, stale.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxBatchOperations caps how many operations a single /batch call may carry.
+const maxBatchOperations = 100
+
+type txKey struct{}
+
+// dbFor returns the handle a handler should query with: the enclosing /batch
+// transaction when there is one, otherwise the shared DB bound to the
+// request's context.
+func dbFor(r *http.Request) *gorm.DB {
+	if tx, ok := batchTx(r); ok {
+		return tx
+	}
+	return DB.WithContext(r.Context())
+}
+
+// batchTx returns the enclosing /batch transaction, if any.
+func batchTx(r *http.Request) (*gorm.DB, bool) {
+	tx, ok := r.Context().Value(txKey{}).(*gorm.DB)
+	return tx, ok
+}
+
+// inBatch reports whether r is an operation dispatched by /batch.
+func inBatch(r *http.Request) bool {
+	_, ok := batchTx(r)
+	return ok
+}
+
+type batchOperation struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type batchResponse struct {
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// batchHandler serves POST /batch. Each operation is dispatched through the
+// regular routes inside one transaction; if any of them fails the whole batch
+// is rolled back and the response carries the failing operation's status.
+type batchHandler struct {
+	dispatch http.Handler
+}
+
+var errBatchFailed = errors.New("batch operation failed")
+
+func (h *batchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	var ops []batchOperation
+	if !decodeJSON(w, r, &ops) {
+		return
+	}
+	if len(ops) == 0 {
+		http.Error(w, "Batch must contain at least one operation", http.StatusBadRequest)
+		return
+	}
+	if len(ops) > maxBatchOperations {
+		http.Error(w, fmt.Sprintf("Batch may contain at most %d operations", maxBatchOperations), http.StatusBadRequest)
+		return
+	}
+	for i, op := range ops {
+		if err := op.validate(); err != nil {
+			http.Error(w, fmt.Sprintf("operation %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp := batchResponse{Results: make([]batchResult, 0, len(ops))}
+	status := http.StatusOK
+	err := DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		ctx := context.WithValue(r.Context(), txKey{}, tx)
+		for _, op := range ops {
+			res := h.run(ctx, r, op)
+			resp.Results = append(resp.Results, res)
+			if res.Status >= 400 {
+				status = res.Status
+				return errBatchFailed
+			}
+		}
+		// Do not commit for a client that has gone away.
+		return r.Context().Err()
+	})
+	if clientGone(r, err) {
+		return
+	}
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Committed = err == nil
+	respondJSON(w, status, resp)
+}
+
+func (op batchOperation) validate() error {
+	switch op.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		return fmt.Errorf("unsupported method %q", op.Method)
+	}
+	if !strings.HasPrefix(op.Path, "/") {
+		return fmt.Errorf("path %q must start with /", op.Path)
+	}
+	if strings.HasPrefix(op.Path, "/batch") {
+		return errors.New("batches cannot be nested")
+	}
+	return nil
+}
+
+// run dispatches a single operation and captures its response. The caller's
+// Authorization header is forwarded so admin-only operations keep working.
+func (h *batchHandler) run(ctx context.Context, parent *http.Request, op batchOperation) batchResult {
+	req, err := http.NewRequestWithContext(ctx, op.Method, op.Path, bytes.NewReader(op.Body))
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, Body: jsonString(err.Error())}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if auth := parent.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	rec := &batchRecorder{header: make(http.Header), status: http.StatusOK}
+	h.dispatch.ServeHTTP(rec, req)
+
+	res := batchResult{Status: rec.status}
+	body := bytes.TrimSpace(rec.body.Bytes())
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		res.Body = body
+	default:
+		res.Body = jsonString(string(body))
+	}
+	return res
+}
+
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// batchRecorder is a minimal in-memory http.ResponseWriter.
+type batchRecorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func (rec *batchRecorder) Header() http.Header { return rec.header }
+
+func (rec *batchRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+func (rec *batchRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
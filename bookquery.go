@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// How a filter treats a parameter that is present but empty, e.g. ?author=.
+const (
+	emptyIgnore = "ignore" // the filter is not applied, as if the parameter were absent
+	emptyMatch  = "match"  // matches books with no value (NULL or "")
+	emptyReject = "reject" // the request is a 400
+)
+
+type bookFilter struct {
+	Param  string
+	Column string
+	Empty  string
+}
+
+// bookFilters are the list filters, with their empty-value behavior:
+//
+//	title     ignore  ?title= lists every book
+//	author    match   ?author= finds books with no author
+//	genre     match   ?genre= finds uncategorized books
+//	currency  match   ?currency= finds books with no currency
+//	language  ignore  ?language= lists every language
+//	isbn      reject  ?isbn= is a 400; an empty ISBN identifies nothing
+//
+// The -empty-filters flag overrides these per filter, e.g.
+// "-empty-filters=author:ignore,isbn:match".
+//
+// A bare parameter is an exact match. Every filter also takes the
+// case-insensitive operator suffixes __eq, __contains and __startswith,
+// e.g. ?author__contains=tolk or ?title__startswith=the; these need a
+// non-empty value.
+var bookFilters = []bookFilter{
+	{Param: "title", Column: "book_name", Empty: emptyIgnore},
+	{Param: "author", Column: "author", Empty: emptyMatch},
+	{Param: "genre", Column: "genre", Empty: emptyMatch},
+	{Param: "currency", Column: "currency", Empty: emptyMatch},
+	{Param: "language", Column: "language", Empty: emptyIgnore},
+	{Param: "isbn", Column: "isbn", Empty: emptyReject},
+}
+
+// applyEmptyFilterOverrides parses the -empty-filters flag value.
+func applyEmptyFilterOverrides(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		param, mode, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return fmt.Errorf("invalid -empty-filters entry %q: want filter:mode", item)
+		}
+		switch mode {
+		case emptyIgnore, emptyMatch, emptyReject:
+		default:
+			return fmt.Errorf("invalid -empty-filters mode %q for %s: must be ignore, match or reject", mode, param)
+		}
+		found := false
+		for i := range bookFilters {
+			if bookFilters[i].Param == param {
+				bookFilters[i].Empty = mode
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("invalid -empty-filters entry %q: unknown filter", param)
+		}
+	}
+	return nil
+}
+
+// Sort orders accepted by ?sort=.
+const (
+	sortID     = ""
+	sortRating = "rating"
+)
+
+// Operator suffixes accepted after a filter name, as in author__contains.
+const (
+	opExact      = ""
+	opEq         = "eq"
+	opContains   = "contains"
+	opStartsWith = "startswith"
+)
+
+var filterOps = []string{opEq, opContains, opStartsWith}
+
+type filterClause struct {
+	Column string
+	Op     string
+	Value  string // empty means "has no value"; only used with opExact
+}
+
+// BookQuery is the filter, sort and paging spec shared by every endpoint
+// that selects a set of books (list, count, facets, bulk updates), so they
+// always agree on what a given query string matches. Adding a filter to
+// bookFilters makes it available everywhere at once.
+type BookQuery struct {
+	IncludeDeleted bool
+	Sort           string
+	Page           page
+	// Range is set when the client asked for `Range: items=N-M`; Page then
+	// describes the same window.
+	Range *itemsRange
+
+	filters []filterClause
+	key     string
+}
+
+// ParseBookQuery reads a BookQuery from the request's query string and
+// Range header.
+func ParseBookQuery(r *http.Request) (BookQuery, error) {
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		return bq, err
+	}
+
+	switch sort := r.URL.Query().Get("sort"); sort {
+	case sortID, sortRating:
+		bq.Sort = sort
+	default:
+		return bq, fmt.Errorf("invalid sort %q: must be rating", sort)
+	}
+
+	if bq.Page, err = parsePage(r); err != nil {
+		return bq, err
+	}
+	if rng, ok := parseItemsRange(r.Header.Get("Range")); ok {
+		bq.Range = &rng
+		bq.Page = rng.page()
+	}
+	return bq, nil
+}
+
+// ParseBookFilters reads only the filters and include_deleted, for endpoints
+// that aggregate over the matched set (counts, facets, stats, bulk updates)
+// and so have no use for sort, paging or Range; a bad value in those is not
+// their concern.
+func ParseBookFilters(r *http.Request) (BookQuery, error) {
+	q := r.URL.Query()
+	bq := BookQuery{IncludeDeleted: q.Get("include_deleted") == "true"}
+
+	if err := checkFilterOps(q); err != nil {
+		return bq, err
+	}
+	canonical := url.Values{}
+	for _, f := range bookFilters {
+		for _, op := range append([]string{opExact}, filterOps...) {
+			param := f.Param
+			if op != opExact {
+				param += "__" + op
+			}
+			values, ok := q[param]
+			if !ok {
+				continue
+			}
+			v := strings.TrimSpace(values[0])
+			if f.Param == "isbn" {
+				v = normalizeISBN(v)
+			}
+			if v == "" {
+				if op != opExact {
+					return bq, fmt.Errorf("filter %s must not be empty", param)
+				}
+				switch f.Empty {
+				case emptyReject:
+					return bq, fmt.Errorf("filter %s must not be empty", f.Param)
+				case emptyIgnore:
+					continue
+				}
+			}
+			bq.filters = append(bq.filters, filterClause{Column: f.Column, Op: op, Value: v})
+			canonical.Set(param, v)
+		}
+	}
+	bq.key = canonical.Encode()
+	if bq.IncludeDeleted {
+		bq.key = "deleted:" + bq.key
+	}
+	return bq, nil
+}
+
+// Apply narrows db to the books the query matches, without ordering or
+// paging, which makes it suitable for counts and aggregates too.
+func (bq BookQuery) Apply(db *gorm.DB) *gorm.DB {
+	db = db.Model(&Book{})
+	if bq.IncludeDeleted {
+		db = db.Unscoped()
+	}
+	for _, f := range bq.filters {
+		switch {
+		case f.Op == opEq:
+			db = db.Where("LOWER("+f.Column+") = LOWER(?)", f.Value)
+		case f.Op == opContains:
+			db = db.Where("LOWER("+f.Column+`) LIKE LOWER(?) ESCAPE '\'`, "%"+escapeLike(f.Value)+"%")
+		case f.Op == opStartsWith:
+			db = db.Where("LOWER("+f.Column+`) LIKE LOWER(?) ESCAPE '\'`, escapeLike(f.Value)+"%")
+		case f.Value != "":
+			db = db.Where(f.Column+" = ?", f.Value)
+		default:
+			db = db.Where("(" + f.Column + " IS NULL OR " + f.Column + " = '')")
+		}
+	}
+	return db
+}
+
+// checkFilterOps rejects parameters that name a filter with an unknown
+// operator suffix, so a typo such as author__contain is not silently
+// ignored.
+func checkFilterOps(q url.Values) error {
+	for param := range q {
+		name, op, ok := strings.Cut(param, "__")
+		if !ok {
+			continue
+		}
+		known := false
+		for _, f := range bookFilters {
+			known = known || f.Param == name
+		}
+		if !known {
+			continue
+		}
+		valid := false
+		for _, o := range filterOps {
+			valid = valid || o == op
+		}
+		if !valid {
+			return fmt.Errorf("invalid filter %s: operator must be eq, contains or startswith", param)
+		}
+	}
+	return nil
+}
+
+// likeEscaper escapes LIKE wildcards (SQL Server also treats [ as one) so
+// user input only ever matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "[", `\[`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Paginate orders and windows a query built with Apply. The default order
+// is by id, which keeps paging stable. "rating" sorts by average review
+// rating, highest first, with unreviewed books last; SQL Server puts NULLs
+// first in ascending order, so the CASE expression pushes them explicitly.
+func (bq BookQuery) Paginate(db *gorm.DB) *gorm.DB {
+	if bq.Sort == sortRating {
+		db = db.
+			Joins("LEFT JOIN " + bookRatings + " AS ratings ON ratings.book_id = books.id").
+			Order("CASE WHEN ratings.avg_rating IS NULL THEN 1 ELSE 0 END").
+			Order("ratings.avg_rating DESC")
+	}
+	return bq.Page.apply(db.Order("books.id"))
+}
+
+// Key identifies the set of books the query matches, ignoring sort and
+// paging. Equal keys always match the same rows.
+func (bq BookQuery) Key() string {
+	return bq.key
+}
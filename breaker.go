@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Circuit breaker states.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops sending requests to a failing database. After
+// threshold consecutive outage errors it opens and requests fail fast with
+// 503 for the cooldown; then it lets a single probe request through
+// (half-open) and closes again if that succeeds.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+var dbBreaker *circuitBreaker
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, state: breakerClosed}
+}
+
+// allow reports whether a request may proceed. When it may not, retryAfter
+// is how long until the breaker will let a probe through. probe is true for
+// the single request admitted in the half-open state; the caller must call
+// endProbe when it finishes.
+func (b *circuitBreaker) allow() (ok, probe bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+			return false, false, wait
+		}
+		b.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return false, false, time.Second
+		}
+		b.probing = true
+		return true, true, 0
+	}
+	return true, false, 0
+}
+
+// endProbe frees the half-open slot when the probe request finishes. If the
+// probe reached the database, record has already closed or reopened the
+// breaker; otherwise the next request gets to probe.
+func (b *circuitBreaker) endProbe() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) record(err error) {
+	if errors.Is(err, context.Canceled) {
+		return // the client went away; says nothing about the database
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !isDBOutage(err) {
+		b.failures = 0
+		b.state = breakerClosed
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+// observe registers GORM callbacks that feed every statement's outcome to
+// the breaker.
+func (b *circuitBreaker) observe(db *gorm.DB) error {
+	hook := func(tx *gorm.DB) {
+		// A statement cut off by its caller's deadline (such as the
+		// /books/stats budget) says nothing about the database.
+		if tx.Statement.Context.Err() == nil {
+			b.record(tx.Error)
+		}
+	}
+	cb := db.Callback()
+	if err := cb.Query().After("gorm:query").Register("breaker:query", hook); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("breaker:create", hook); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("breaker:update", hook); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("breaker:delete", hook); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("breaker:row", hook); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("breaker:raw", hook)
+}
+
+// guardDB fast-fails requests with 503 and Retry-After while the database
+// breaker is open. It only wraps the database-backed routes.
+func guardDB(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Batch operations were admitted with the outer /batch request.
+		if inBatch(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, probe, retryAfter := dbBreaker.allow()
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Database unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if probe {
+			defer dbBreaker.endProbe()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type readiness struct {
+	Status    string `json:"status"`
+	DBBreaker string `json:"db_breaker,omitempty"`
+}
+
+// Ready serves GET /readyz. The instance is not ready while the database is
+// not connected or its breaker is open.
+func Ready(w http.ResponseWriter, r *http.Request) {
+	res := readiness{Status: "ready"}
+	status := http.StatusOK
+	if dbBreaker != nil {
+		res.DBBreaker = dbBreaker.State()
+		if res.DBBreaker == breakerOpen {
+			res.Status, status = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	if DB == nil {
+		res.Status, status = "unavailable", http.StatusServiceUnavailable
+	}
+	respondJSON(w, status, res)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	b := newCircuitBreaker(2, 50*time.Millisecond)
+	outage := driver.ErrBadConn
+
+	b.record(outage)
+	if ok, _, _ := b.allow(); !ok || b.State() != breakerClosed {
+		t.Fatalf("one failure below the threshold opened the breaker")
+	}
+	b.record(nil)
+	b.record(outage)
+	if b.State() != breakerClosed {
+		t.Fatalf("a success did not reset the failure count")
+	}
+	b.record(outage)
+	if b.State() != breakerOpen {
+		t.Fatalf("state = %s after reaching the threshold, want open", b.State())
+	}
+	if ok, _, retryAfter := b.allow(); ok || retryAfter <= 0 {
+		t.Fatalf("open breaker allowed a request (retryAfter %s)", retryAfter)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	ok, probe, _ := b.allow()
+	if !ok || !probe {
+		t.Fatalf("after the cooldown allow() = %t, probe %t, want a probe", ok, probe)
+	}
+	if ok, _, _ := b.allow(); ok {
+		t.Fatalf("a second request got through while the probe was running")
+	}
+	b.record(outage)
+	b.endProbe()
+	if b.State() != breakerOpen {
+		t.Fatalf("a failed probe left the breaker %s, want open", b.State())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, probe, _ := b.allow(); !ok || !probe {
+		t.Fatal("no probe after the second cooldown")
+	}
+	b.record(nil)
+	b.endProbe()
+	if b.State() != breakerClosed {
+		t.Fatalf("a successful probe left the breaker %s, want closed", b.State())
+	}
+}
+
+func TestCircuitBreakerIgnoresStatementErrors(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	for _, err := range []error{
+		context.Canceled,
+		mssql.Error{Number: 2627, Message: "Violation of UNIQUE KEY constraint"},
+		errors.New("record not found"),
+	} {
+		b.record(err)
+		if b.State() != breakerClosed {
+			t.Fatalf("%v opened the breaker", err)
+		}
+	}
+	b.record(mssql.Error{Number: 40613, Message: "Database is not currently available"})
+	if b.State() != breakerOpen {
+		t.Fatal("a transient Azure SQL error did not count as an outage")
+	}
+}
+
+func TestDBMiddlewaresOnlyWrapDatabaseRoutes(t *testing.T) {
+	withConfig(t)
+	saved, savedSlots := dbBreaker, dbSlots
+	t.Cleanup(func() { dbBreaker, dbSlots = saved, savedSlots })
+	dbBreaker = newCircuitBreaker(1, time.Minute)
+	dbBreaker.record(driver.ErrBadConn)
+	cfg.DBMaxConcurrent = 1
+	cfg.DBQueueTimeout = 10 * time.Millisecond
+	router := newRouter()
+	if err := dbSlots.Acquire(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	defer dbSlots.Release(1)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/schema/book", http.StatusOK},
+		{"GET", "/readyz", http.StatusServiceUnavailable}, // answered, reporting the open breaker
+		{"GET", "/books", http.StatusServiceUnavailable},
+		{"GET", "/book/1", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+		if tt.path == "/readyz" && time.Since(start) >= cfg.DBQueueTimeout {
+			t.Errorf("/readyz waited for a database slot")
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// flushableCache is implemented by the in-process caches so operators can
+// reset them from /admin/cache/flush without restarting the service.
+type flushableCache interface {
+	// Flush drops every entry and reports how many were removed.
+	Flush() int
+	// Warm repopulates the cache's most useful entries.
+	Warm(ctx context.Context) error
+}
+
+var (
+	cachesMu sync.Mutex
+	caches   = map[string]flushableCache{}
+)
+
+// registerCache adds a cache to the set flushed by /admin/cache/flush.
+func registerCache(name string, c flushableCache) {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	caches[name] = c
+}
+
+type cacheFlushResult struct {
+	Flushed   int    `json:"flushed"`
+	Warmed    bool   `json:"warmed,omitempty"`
+	WarmError string `json:"warm_error,omitempty"`
+}
+
+// FlushCaches serves POST /admin/cache/flush. It empties every registered
+// cache and, with ?warm=true, repopulates them straight away. The response
+// maps each cache name to what was done with it.
+func FlushCaches(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	warm := r.URL.Query().Get("warm") == "true"
+
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	results := make(map[string]cacheFlushResult, len(caches))
+	for name, c := range caches {
+		res := cacheFlushResult{Flushed: c.Flush()}
+		if warm {
+			if err := c.Warm(r.Context()); err != nil {
+				res.WarmError = err.Error()
+			} else {
+				res.Warmed = true
+			}
+		}
+		results[name] = res
+	}
+	respondJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxSnapshotKeys is how many of the hottest count keys a snapshot keeps.
+const maxSnapshotKeys = 100
+
+// cacheSnapshot is what -cache-snapshot persists across restarts: the
+// filters whose counts were looked up most. The counts themselves are not
+// kept, since the catalog may have changed while the service was down; on
+// startup they are recounted before the instance reports ready.
+type cacheSnapshot struct {
+	SavedAt   time.Time `json:"saved_at"`
+	CountKeys []string  `json:"count_keys"`
+}
+
+// saveCacheSnapshot writes the hottest count keys to path, through a
+// temporary file in the same directory so a crash never leaves half a
+// snapshot behind.
+func saveCacheSnapshot(path string) error {
+	if bookCounts == nil {
+		return nil
+	}
+	data, err := json.Marshal(cacheSnapshot{SavedAt: time.Now().UTC(), CountKeys: bookCounts.hottest(maxSnapshotKeys)})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// restoreCacheSnapshot recounts the keys saved in path and caches the
+// results, so the first requests after a deploy find them warm. A missing
+// snapshot is not an error: there is none before the first shutdown. Keys
+// that no longer parse, say after a filter was removed, are skipped.
+func restoreCacheSnapshot(ctx context.Context, path string) (int, error) {
+	if bookCounts == nil {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var snap cacheSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("reading cache snapshot %s: %w", path, err)
+	}
+	warmed := 0
+	for i, key := range snap.CountKeys {
+		bq, err := parseCountKey(key)
+		if err != nil || bq.Key() != key {
+			log.Printf("WARNING: skipping cache snapshot key %q: no longer a valid filter", key)
+			continue
+		}
+		var total int64
+		if err := bq.Apply(DB.WithContext(ctx)).Count(&total).Error; err != nil {
+			return warmed, err
+		}
+		// Ranked hits keep the order for the next snapshot even if
+		// traffic is light until then.
+		bookCounts.restore(key, total, int64(len(snap.CountKeys)-i))
+		warmed++
+	}
+	return warmed, nil
+}
+
+// parseCountKey turns a BookQuery key back into the query it came from.
+func parseCountKey(key string) (BookQuery, error) {
+	query, deleted := strings.CutPrefix(key, "deleted:")
+	if deleted {
+		query += "&include_deleted=true"
+	}
+	return ParseBookFilters(&http.Request{URL: &url.URL{RawQuery: query}})
+}
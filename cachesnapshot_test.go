@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCountCacheHottest(t *testing.T) {
+	c := newCountCache(time.Minute)
+	for key, n := range map[string]int{"genre=SF": 3, "": 5, "author=Herbert": 1, "genre=Fantasy": 3} {
+		for i := 0; i < n; i++ {
+			c.get(key)
+		}
+	}
+	c.Flush()
+	if got, want := c.hottest(3), []string{"", "genre=Fantasy", "genre=SF"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hottest(3) = %q, want %q", got, want)
+	}
+}
+
+func TestParseCountKeyRoundTrips(t *testing.T) {
+	withConfig(t)
+	for _, key := range []string{"", "genre=SF", "author__contains=her&genre=SF", "deleted:", "deleted:genre=SF"} {
+		bq, err := parseCountKey(key)
+		if err != nil || bq.Key() != key {
+			t.Errorf("parseCountKey(%q) = key %q, err %v", key, bq.Key(), err)
+		}
+	}
+}
+
+func TestCacheSnapshotSurvivesRestart(t *testing.T) {
+	withConfig(t)
+	savedDB, savedCounts := DB, bookCounts
+	t.Cleanup(func() { DB, bookCounts = savedDB, savedCounts })
+	DB = dryRunDB(t)
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	bookCounts = newCountCache(time.Minute)
+	if n, err := restoreCacheSnapshot(context.Background(), path); n != 0 || err != nil {
+		t.Fatalf("restore without a snapshot: %d, %v; want 0, nil", n, err)
+	}
+	bookCounts.get("genre=SF")
+	bookCounts.get("genre=SF")
+	bookCounts.get("")
+	bookCounts.get("no_such_filter=1")
+	if err := saveCacheSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("snapshot directory holds %d files, want only the snapshot", len(entries))
+	}
+
+	bookCounts = newCountCache(time.Minute)
+	n, err := restoreCacheSnapshot(context.Background(), path)
+	if err != nil || n != 2 {
+		t.Fatalf("restore: %d, %v; want 2 keys warmed and the invalid one skipped", n, err)
+	}
+	for _, key := range []string{"genre=SF", ""} {
+		if _, ok := bookCounts.get(key); !ok {
+			t.Errorf("%q not cached after restore", key)
+		}
+	}
+	if got := bookCounts.hottest(1); len(got) != 1 || got[0] != "genre=SF" {
+		t.Errorf("hottest after restore = %q, want genre=SF first", got)
+	}
+}
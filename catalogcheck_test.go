@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateCatalog(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.AdminToken = "secret"
+	books := []Book{{BookName: "Fine", ISBN: "9780441013593"}, {BookName: "Bad ISBN"}, {BookName: "Pricey"}}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Rows written before today's rules, bypassing validation.
+	if err := db.Exec("UPDATE books SET isbn = '9780441013590' WHERE id = ?", books[1].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE books SET price = 2000000 WHERE id = ?", books[2].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/validate-catalog", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	ValidateCatalog(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got catalogValidation
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Checked != 3 || got.Invalid != 2 || len(got.Books) != 2 {
+		t.Fatalf("report = %+v, want 3 checked and 2 invalid", got)
+	}
+	for i, want := range []struct {
+		id    uint
+		field string
+	}{{books[1].ID, "isbn"}, {books[2].ID, "price"}} {
+		if b := got.Books[i]; b.ID != want.id || len(b.Errors) != 1 || b.Errors[0].Field != want.field {
+			t.Errorf("invalid book %d = %+v, want id %d with a %s error", i, b, want.id, want.field)
+		}
+	}
+}
+
+func TestValidateCatalogRequiresAdmin(t *testing.T) {
+	withConfig(t)
+	cfg.AdminToken = "secret"
+	saved := DB
+	DB = dryRunDB(t)
+	t.Cleanup(func() { DB = saved })
+	rec := httptest.NewRecorder()
+	ValidateCatalog(rec, httptest.NewRequest("GET", "/admin/validate-catalog", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without the token: %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// bookETag is the entity tag of a single book. It changes whenever the row
+// is saved, because UpdatedAt does.
+func bookETag(b Book) string {
+	return fmt.Sprintf(`"%d-%d"`, b.ID, b.UpdatedAt.UnixNano())
+}
+
+// preferReturn returns the return= preference from the Prefer header
+// (RFC 7240), e.g. "minimal", "representation" or "changed".
+func preferReturn(r *http.Request) string {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(pref, ";")
+			if v, ok := strings.CutPrefix(strings.TrimSpace(token), "return="); ok {
+				return strings.Trim(v, `"`)
+			}
+		}
+	}
+	return ""
+}
+
+// wantsChangedOnly reports whether an update should answer with just the
+// changed fields, via `Prefer: return=changed` or ?return=changed.
+func wantsChangedOnly(r *http.Request) bool {
+	return r.URL.Query().Get("return") == "changed" || preferReturn(r) == "changed"
+}
+
+type changedFields struct {
+	ID      uint                   `json:"id"`
+	ETag    string                 `json:"etag"`
+	Changed map[string]interface{} `json:"changed"`
+}
+
+// diffBooks returns the JSON fields whose values differ between before and
+// after, keyed by their JSON names. UpdatedAt is left out: it changes on
+// every save and the new ETag already reflects it.
+func diffBooks(before, after Book) (map[string]interface{}, error) {
+	old, err := bookFields(before)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := bookFields(after)
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]interface{}{}
+	for k, v := range cur {
+		if k == "UpdatedAt" {
+			continue
+		}
+		if prev, ok := old[k]; !ok || !reflect.DeepEqual(prev, v) {
+			changed[k] = v
+		}
+	}
+	// A field that became empty is dropped by omitempty; report it as null.
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			changed[k] = nil
+		}
+	}
+	return changed, nil
+}
+
+func bookFields(b Book) (map[string]interface{}, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// respondChanged writes the changed-fields representation of an update.
+func respondChanged(w http.ResponseWriter, before, after Book) {
+	changed, err := diffBooks(before, after)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Preference-Applied", "return=changed")
+	respondJSON(w, http.StatusOK, changedFields{ID: after.ID, ETag: bookETag(after), Changed: changed})
+}
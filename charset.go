@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Accept-Charset handling accepted by -accept-charset.
+const (
+	charsetIgnore = "ignore" // Accept-Charset is ignored, as RFC 9110 allows
+	charsetStrict = "strict" // requests that rule out utf-8 get a 406
+)
+
+// acceptsUTF8 reports whether an Accept-Charset header allows utf-8, the
+// only charset we produce: listed by name, or matched by "*" without being
+// excluded, with a non-zero q. A missing or empty header allows anything.
+// Entries with an unreadable q-value are skipped.
+func acceptsUTF8(header string) bool {
+	if strings.TrimSpace(header) == "" {
+		return true
+	}
+	utf8Q, wildcardQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "utf-8":
+			utf8Q = max(utf8Q, q)
+		case "*":
+			wildcardQ = max(wildcardQ, q)
+		}
+	}
+	if utf8Q >= 0 {
+		return utf8Q > 0
+	}
+	return wildcardQ > 0
+}
+
+// requireUTF8 answers 406 Not Acceptable to requests whose Accept-Charset
+// rules out utf-8, instead of sending them utf-8 anyway.
+func requireUTF8(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsUTF8(r.Header.Get("Accept-Charset")) {
+			http.Error(w, "Not Acceptable: responses are only available in utf-8", http.StatusNotAcceptable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsUTF8(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		want   bool
+	}{
+		{"", true},
+		{"utf-8", true},
+		{"UTF-8;q=0.5", true},
+		{"iso-8859-1, utf-8;q=0.1", true},
+		{"*", true},
+		{"iso-8859-1", false},
+		{"utf-8;q=0", false},
+		{"*;q=0", false},
+		{"utf-8;q=0, *", false},
+		{"utf-8;q=0.5, *;q=0", true},
+		{"iso-8859-1, *;q=0.1", true},
+		{"utf-8;q=x", false},
+	} {
+		if got := acceptsUTF8(tt.header); got != tt.want {
+			t.Errorf("acceptsUTF8(%q) = %t, want %t", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestStrictAcceptCharset(t *testing.T) {
+	withConfig(t)
+	for _, mode := range []string{charsetIgnore, charsetStrict} {
+		cfg.AcceptCharset = mode
+		req := httptest.NewRequest("GET", "/schema/book", nil)
+		req.Header.Set("Accept-Charset", "iso-8859-1")
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, req)
+
+		want := http.StatusOK
+		if mode == charsetStrict {
+			want = http.StatusNotAcceptable
+		}
+		if rec.Code != want {
+			t.Errorf("-accept-charset=%s: status %d, want %d", mode, rec.Code, want)
+		}
+	}
+}
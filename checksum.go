@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// checksumColumns are the book columns the catalog checksum covers: the id
+// and updated_at, which change on every save, plus the fields a replica
+// copies, so one that was written to directly does not match either.
+var checksumColumns = []string{"id", "updated_at", "book_name", "author", "price", "genre", "currency", "language", "isbn", "stock"}
+
+type catalogChecksum struct {
+	Count       int64      `json:"count"`
+	Checksum    int32      `json:"checksum"`
+	LastUpdated *time.Time `json:"last_updated"`
+	Algorithm   string     `json:"algorithm"`
+	Columns     []string   `json:"columns"`
+}
+
+// GetChecksum serves GET /books/checksum: a fingerprint of the active books
+// for checking that a downstream copy is in sync without diffing records.
+// It is computed in one pass in SQL, as CHECKSUM_AGG over BINARY_CHECKSUM of
+// checksumColumns, so a copy on SQL Server can run the same aggregate and
+// compare. BINARY_CHECKSUM is case-sensitive, unlike CHECKSUM. The checksum
+// is XOR-based, so two identical changes can cancel out; the row count and
+// the newest updated_at are returned alongside to catch what it misses.
+// Accepts the same filters as GetBooks, for comparing one slice at a time.
+func GetChecksum(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+
+	var row struct {
+		Count       int64
+		Checksum    int32
+		LastUpdated sql.NullTime
+	}
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		row.Count, row.Checksum, row.LastUpdated = 0, 0, sql.NullTime{}
+		return bq.Apply(db).
+			Select("COUNT(*) AS count, " +
+				"COALESCE(CHECKSUM_AGG(BINARY_CHECKSUM(" + strings.Join(checksumColumns, ", ") + ")), 0) AS checksum, " +
+				"MAX(updated_at) AS last_updated").
+			Scan(&row).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res := catalogChecksum{
+		Count:     row.Count,
+		Checksum:  row.Checksum,
+		Algorithm: "CHECKSUM_AGG(BINARY_CHECKSUM)",
+		Columns:   checksumColumns,
+	}
+	if row.LastUpdated.Valid {
+		t := row.LastUpdated.Time.UTC()
+		res.LastUpdated = &t
+	}
+	respondJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChecksumTracksChanges(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	get := func(query string) catalogChecksum {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		GetChecksum(rec, httptest.NewRequest("GET", "/books/checksum"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var c catalogChecksum
+		if err := json.Unmarshal(rec.Body.Bytes(), &c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if empty := get(""); empty.Count != 0 || empty.Checksum != 0 || empty.LastUpdated != nil {
+		t.Errorf("empty catalog checksum = %+v", empty)
+	}
+	books := []Book{{BookName: "Dune", Author: "Herbert"}, {BookName: "Emma", Author: "Austen"}}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	before := get("")
+	if before.Count != 2 || before.LastUpdated == nil {
+		t.Errorf("checksum = %+v, want 2 books and a last_updated", before)
+	}
+	if again := get(""); again.Checksum != before.Checksum {
+		t.Errorf("checksum changed without a write: %d then %d", before.Checksum, again.Checksum)
+	}
+
+	// A direct write that keeps updated_at, as a drifted replica might have.
+	if err := db.Exec("UPDATE books SET author = 'herbert' WHERE id = ?", books[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after := get(""); after.Checksum == before.Checksum {
+		t.Error("checksum did not change when an author's case changed")
+	}
+	if sliced := get("?author=Austen"); sliced.Count != 1 {
+		t.Errorf("filtered checksum counted %d books, want 1", sliced.Count)
+	}
+}
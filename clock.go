@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+type clockReport struct {
+	ServerTime  time.Time `json:"server_time"`
+	DBTime      time.Time `json:"db_time"`
+	SkewMS      float64   `json:"skew_ms"`
+	RoundTripMS float64   `json:"round_trip_ms"`
+}
+
+// measureSkew compares the database's clock with ours. The database read
+// its clock somewhere between sent and received, so it is compared with the
+// midpoint; the error is at most half the round trip. A positive skew means
+// the database is ahead.
+func measureSkew(sent, received, dbTime time.Time) clockReport {
+	rtt := received.Sub(sent)
+	mid := sent.Add(rtt / 2)
+	return clockReport{
+		ServerTime:  mid.UTC(),
+		DBTime:      dbTime.UTC(),
+		SkewMS:      float64(dbTime.Sub(mid)) / float64(time.Millisecond),
+		RoundTripMS: float64(rtt) / float64(time.Millisecond),
+	}
+}
+
+// GetClock serves GET /admin/time: this server's clock next to the primary
+// database's (SYSUTCDATETIME()), for diagnosing skew between the app and
+// Azure SQL that would break timestamp-based sync. Admin-only.
+func GetClock(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	var dbTime time.Time
+	sent := time.Now()
+	if err := dbFor(r).Raw("SELECT SYSUTCDATETIME()").Scan(&dbTime).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, measureSkew(sent, time.Now(), dbTime))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMeasureSkew(t *testing.T) {
+	sent := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	received := sent.Add(40 * time.Millisecond)
+	got := measureSkew(sent, received, sent.Add(1520*time.Millisecond))
+	if got.SkewMS != 1500 || got.RoundTripMS != 40 {
+		t.Errorf("skew = %vms, round trip = %vms; want 1500ms and 40ms", got.SkewMS, got.RoundTripMS)
+	}
+	if !got.ServerTime.Equal(sent.Add(20 * time.Millisecond)) {
+		t.Errorf("server_time = %s, want the round trip's midpoint", got.ServerTime)
+	}
+	if got := measureSkew(sent, received, sent); got.SkewMS != -20 {
+		t.Errorf("database behind: skew = %vms, want -20ms", got.SkewMS)
+	}
+}
+
+func TestGetClockRequiresAdmin(t *testing.T) {
+	withConfig(t)
+	cfg.AdminToken = "secret"
+	saved := DB
+	DB = dryRunDB(t)
+	t.Cleanup(func() { DB = saved })
+	rec := httptest.NewRecorder()
+	GetClock(rec, httptest.NewRequest("GET", "/admin/time", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without the token: %d, want 401", rec.Code)
+	}
+}
+
+func TestGetClock(t *testing.T) {
+	withConfig(t)
+	testDB(t)
+	cfg.AdminToken = "secret"
+	req := httptest.NewRequest("GET", "/admin/time", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/time = %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// collectionVersion summarizes when a filtered set of books last changed.
+// The timestamps are taken over the whole books table, deleted rows
+// included: soft deletes only touch deleted_at, and a book edited so that it
+// no longer matches the filters leaves the matched set's own MAX(updated_at)
+// unchanged. Active counts the matched set itself and Total the matched rows
+// with the trashed ones: purging the trash removes rows without touching any
+// timestamp that is left. Lists sorted by rating also depend on reviews, so
+// for those the reviews table is versioned too.
+type collectionVersion struct {
+	LastUpdated       sql.NullTime
+	LastDeleted       sql.NullTime
+	LastReviewUpdated sql.NullTime
+	LastReviewDeleted sql.NullTime
+	Active            int64
+	Total             int64
+	Reviews           int64
+}
+
+func (v collectionVersion) lastModified() time.Time {
+	var t time.Time
+	for _, ts := range []sql.NullTime{v.LastUpdated, v.LastDeleted, v.LastReviewUpdated, v.LastReviewDeleted} {
+		if ts.Valid && ts.Time.After(t) {
+			t = ts.Time
+		}
+	}
+	return t
+}
+
+// loadCollectionVersion computes the version of the books matched by bq.
+func loadCollectionVersion(db *gorm.DB, bq BookQuery) (collectionVersion, error) {
+	columns := "(SELECT MAX(updated_at) FROM books) AS last_updated, " +
+		"(SELECT MAX(deleted_at) FROM books) AS last_deleted, " +
+		"COUNT(CASE WHEN books.deleted_at IS NULL THEN 1 END) AS active, COUNT(*) AS total"
+	if bq.Sort == sortRating {
+		columns += ", (SELECT MAX(updated_at) FROM reviews) AS last_review_updated, " +
+			"(SELECT MAX(deleted_at) FROM reviews) AS last_review_deleted, " +
+			"(SELECT COUNT(*) FROM reviews WHERE deleted_at IS NULL) AS reviews"
+	}
+	var v collectionVersion
+	err := bq.Apply(db).Unscoped().Select(columns).Scan(&v).Error
+	return v, err
+}
+
+// representationHeaders are the request headers that change which
+// representation of a list is returned; they are hashed into the ETag and
+// listed in Vary.
+var representationHeaders = []string{"Accept", "Range", "Prefer"}
+
+// etag derives a weak entity tag from the version and the representation
+// the client asked for (query string, Accept, Range and Prefer), so
+// different pages, windows or shapes of the same set never share a tag.
+func (v collectionVersion) etag(r *http.Request) string {
+	h := fnv.New32a()
+	h.Write([]byte(r.URL.RawQuery))
+	for _, name := range representationHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(r.Header.Get(name)))
+	}
+	return fmt.Sprintf(`W/"%d-%d-%d-%d-%08x"`, v.Active, v.Total, v.Reviews, v.lastModified().UnixNano(), h.Sum32())
+}
+
+// writeCollectionValidators sets ETag and Last-Modified for a list response
+// and reports whether the client's copy is current, in which case a 304 has
+// been written. If-None-Match takes precedence over If-Modified-Since, as in
+// RFC 9110; it is also the precise check, since HTTP dates only have
+// one-second resolution.
+func writeCollectionValidators(w http.ResponseWriter, r *http.Request, v collectionVersion) bool {
+	etag := v.etag(r)
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", strings.Join(representationHeaders, ", "))
+	lastModified := v.lastModified().UTC().Truncate(time.Second)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if since, err := http.ParseTime(ims); err == nil && !lastModified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches applies the weak comparison used for If-None-Match.
+func etagMatches(header, etag string) bool {
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
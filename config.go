@@ -0,0 +1,380 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings for the service.
+type Config struct {
+	Port string
+
+	// Connection settings from the environment. The defaults point at the
+	// project's Azure SQL server and Key Vault.
+	DBHost         string
+	DBPort         string
+	DBName         string
+	DBUser         string
+	KeyVaultURL    string
+	KeyVaultSecret string
+	// KeyVaultDSNSecret optionally names a secret holding the whole DSN.
+	KeyVaultDSNSecret string
+
+	// DBAppName is sent as the connection's "app name", so the service's
+	// sessions can be told apart in sys.dm_exec_sessions.
+	// DBApplicationIntent optionally sets ApplicationIntent on the primary
+	// connection; replica connections always ask for ReadOnly.
+	DBAppName           string
+	DBApplicationIntent string
+
+	// DBReadHost optionally names a read replica that read-only handlers
+	// query instead of the primary.
+	DBReadHost string
+
+	Migrate       bool
+	TrailingSlash string
+	AdminToken    string
+	Debug         bool
+	AllowMigrate  bool
+
+	// H2C serves HTTP/2 over cleartext alongside HTTP/1.1.
+	H2C bool
+
+	// TLSCert and TLSKey switch the listener to HTTPS. HTTPRedirectPort then
+	// optionally answers plain HTTP with a redirect to it.
+	TLSCert          string
+	TLSKey           string
+	HTTPRedirectPort string
+
+	// HSTSMaxAge is sent as Strict-Transport-Security on HTTPS responses
+	// (0 disables the header).
+	HSTSMaxAge time.Duration
+
+	// DrainDelay is how long a shutting-down instance keeps serving while
+	// failing readiness; ShutdownTimeout then bounds in-flight requests.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	// LogPayloads logs the (redacted) bodies of write requests.
+	LogPayloads bool
+
+	// Deprecations maps route templates to their deprecation dates.
+	Deprecations map[string]deprecation
+
+	// ExpandAllowed lists the relations GetBook's ?expand= may load, and
+	// MaxExpand how many of them one request may ask for.
+	ExpandAllowed []string
+	MaxExpand     int
+
+	// CreateDefaults holds the values CreateBook gives fields a new book's
+	// body leaves out.
+	CreateDefaults Book
+
+	// Indexes lists the bookIndexes a migration creates.
+	Indexes []string
+
+	// AllowEnvPassword lets the service start with DB_PASSWORD when the
+	// Key Vault lookup fails.
+	AllowEnvPassword bool
+
+	// JSONNaming selects snake_case (the struct tags) or camelCase keys.
+	JSONNaming string
+
+	// ErrorFormat is how error responses are written to clients that do not
+	// ask for application/problem+json: errorsText or errorsProblem.
+	ErrorFormat string
+
+	// AcceptCharset is how the Accept-Charset header is handled:
+	// charsetIgnore or charsetStrict.
+	AcceptCharset string
+
+	// DefaultAccept stands in for the Accept header of requests that send
+	// none (or only */*).
+	DefaultAccept string
+
+	// ContentLanguage is sent as the Content-Language header when set.
+	ContentLanguage string
+
+	// Paging for GetBooks. A zero DefaultPageSize returns every book unless
+	// the client asks for a page_size; MaxPageSize caps what clients may ask for.
+	DefaultPageSize int
+	MaxPageSize     int
+
+	// FeedSize is how many of the newest books /books/feed.atom lists.
+	FeedSize int
+
+	// PublicBaseURL is the scheme and host clients reach the service at, for
+	// the absolute links in /books/feed.atom. When unset they point at
+	// localhost on -port, over HTTPS if -tls-cert is set.
+	PublicBaseURL string
+
+	// DBMaxConcurrent caps in-flight database operations (0 = unlimited);
+	// requests wait up to DBQueueTimeout for a slot before getting a 503.
+	DBMaxConcurrent int
+	DBQueueTimeout  time.Duration
+
+	// CountCacheTTL is how long book counts are cached (0 disables caching).
+	CountCacheTTL time.Duration
+
+	// CacheSnapshot is the file the hottest cached count filters are saved
+	// to on shutdown and recounted from on startup (empty disables it).
+	CacheSnapshot string
+
+	// StatsBudget is how long the aggregate endpoints (stats, distinct
+	// values, price tiers) may spend before returning partial results.
+	StatsBudget time.Duration
+
+	// StatsTotals is how often the in-memory count and price sum behind the
+	// unfiltered /books/stats are reconciled with the database (0 keeps no
+	// totals and always aggregates in SQL).
+	StatsTotals time.Duration
+
+	// ReadRetries is how many times a read is retried after a transient
+	// database error before the client gets an error (0, the default,
+	// fails it at once).
+	ReadRetries int
+
+	// TrashRetention is how long soft-deleted books are kept before a job
+	// running every PurgeInterval deletes them for good (0 keeps them).
+	TrashRetention time.Duration
+	PurgeInterval  time.Duration
+
+	// BreakerThreshold consecutive database outages open the circuit breaker
+	// for BreakerCooldown (0, the default, disables the breaker).
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Request body limits in bytes, from REGULAR_MAX_BODY and UPLOAD_MAX_BODY.
+	RegularMaxBody int64
+	UploadMaxBody  int64
+}
+
+var cfg Config
+
+// Trailing slash modes accepted by the -trailing-slash flag.
+const (
+	slashOff      = "off"      // "/books/" is not matched (404)
+	slashRedirect = "redirect" // "/books/" is redirected to "/books" (301)
+	slashStrip    = "strip"    // "/books/" is served as "/books" without a redirect
+)
+
+func loadConfig() error {
+	flag.StringVar(&cfg.Port, "port", envOr("PORT", "8082"), "Port to listen on")
+	flag.BoolVar(&cfg.Migrate, "migrate", false, "Run AutoMigrate at startup (also requires ALLOW_MIGRATE=true)")
+	flag.BoolVar(&cfg.Migrate, "initDB", false, "Deprecated alias for -migrate")
+	flag.StringVar(&cfg.TrailingSlash, "trailing-slash", slashOff, "Trailing slash handling: off, redirect or strip")
+	flag.StringVar(&cfg.DefaultAccept, "default-accept", "application/json", `Accept assumed when a request sends none or only */*, e.g. 'application/json; profile="envelope"'`)
+	flag.StringVar(&cfg.ErrorFormat, "error-format", errorsText, "Error response format when the client does not ask for one: text, or problem for application/problem+json (RFC 7807)")
+	flag.StringVar(&cfg.AcceptCharset, "accept-charset", charsetIgnore, "Accept-Charset handling: ignore, or strict to answer 406 when a request rules out utf-8")
+	flag.StringVar(&cfg.ContentLanguage, "content-language", "", "Default Content-Language for responses (e.g. en-US); empty disables the header")
+	flag.BoolVar(&cfg.AllowEnvPassword, "allow-env-password", false, "Fall back to the DB_PASSWORD env var if Key Vault is unreachable (dev/degraded use only)")
+	flag.BoolVar(&cfg.Debug, "debug", false, "Enable debugging aids such as GetBooks?explain=true and the X-DB-Queries header")
+	flag.BoolVar(&cfg.H2C, "h2c", false, "Also accept HTTP/2 over cleartext (h2c), for clients and L7 proxies that multiplex; HTTP/1.1 keeps working")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "TLS certificate file; with -tls-key, serves HTTPS on -port")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "TLS private key file")
+	flag.StringVar(&cfg.HTTPRedirectPort, "http-redirect-port", "", "With TLS, also listen for plain HTTP on this port and redirect it to HTTPS (empty disables)")
+	flag.DurationVar(&cfg.HSTSMaxAge, "hsts-max-age", 0, "Send Strict-Transport-Security with this max-age on HTTPS responses, e.g. 8760h (0 disables)")
+	flag.DurationVar(&cfg.DrainDelay, "drain-delay", 5*time.Second, "On SIGTERM, how long to keep serving with /readyz failing before shutting down")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "How long in-flight requests get to finish at shutdown")
+	flag.BoolVar(&cfg.LogPayloads, "log-payloads", false, "Log the bodies of write requests, redacted and truncated (debugging only: the logs will hold customer data)")
+	flag.IntVar(&cfg.DefaultPageSize, "default-page-size", 0, "Page size used when a list request has no page_size (0 = unlimited)")
+	flag.IntVar(&cfg.MaxPageSize, "max-page-size", 100, "Largest page_size a client may request")
+	flag.IntVar(&cfg.FeedSize, "feed-size", 50, "Number of newest books listed in /books/feed.atom")
+	flag.StringVar(&cfg.PublicBaseURL, "public-base-url", "", "Scheme and host clients reach the service at, e.g. https://books.example.com, for links in /books/feed.atom (empty uses localhost on -port)")
+	flag.IntVar(&cfg.DBMaxConcurrent, "db-max-concurrent", 0, "Maximum concurrent database operations (0 = unlimited)")
+	flag.DurationVar(&cfg.DBQueueTimeout, "db-queue-timeout", 5*time.Second, "How long a request waits for a database slot before a 503")
+	flag.DurationVar(&cfg.CountCacheTTL, "count-cache-ttl", 5*time.Second, "How long to cache book counts (0 disables)")
+	flag.StringVar(&cfg.CacheSnapshot, "cache-snapshot", "", "File to save the most requested count filters to on shutdown and recount before becoming ready, e.g. on an Azure Files mount (empty disables)")
+	flag.DurationVar(&cfg.StatsBudget, "stats-budget", 2*time.Second, "Time budget for /books/stats, /books/distinct and /books/price-tiers; aggregates still pending are left out (X-Partial: true)")
+	flag.DurationVar(&cfg.StatsTotals, "stats-totals", 0, "Keep the unfiltered book count and price sum for /books/stats in memory, reconciled with the database this often, e.g. 1m (0 disables)")
+	flag.IntVar(&cfg.ReadRetries, "read-retries", 0, "Times a read-only request retries a transient database error before failing (0 disables); writes are never retried")
+	flag.DurationVar(&cfg.TrashRetention, "trash-retention", 0, "Permanently delete books soft-deleted longer ago than this, e.g. 720h (0 keeps them forever)")
+	flag.DurationVar(&cfg.PurgeInterval, "purge-interval", time.Hour, "How often the -trash-retention purge runs")
+	flag.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 0, "Consecutive database outages that open the circuit breaker (0 disables)")
+	flag.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", 30*time.Second, "How long the open breaker fails requests fast before probing the database")
+	flag.StringVar(&cfg.JSONNaming, "json-naming", namingSnake, "JSON field naming: snake (book_name) or camel (bookName)")
+	expand := flag.String("expand", "reviews", "Comma-separated relations GET /book/{id}?expand= may load (empty disables expanding)")
+	flag.IntVar(&cfg.MaxExpand, "max-expand", 1, "Most relations a single ?expand= may load")
+	createDefaults := flag.String("create-defaults", "", "Values for fields a POST /books body leaves out, e.g. currency=USD,genre=Uncategorized (fields: "+strings.Join(defaultableFields, ", ")+")")
+	indexes := flag.String("indexes", "author,genre,price,isbn", "Comma-separated book indexes to create when migrating (empty for none)")
+	var deprecated repeatedFlag
+	flag.Var(&deprecated, "deprecated", "Deprecated route as route=since[/sunset] dates, e.g. /books=2026-01-01/2026-07-01; repeat for each route")
+	emptyFilters := flag.String("empty-filters", "", "Per-filter handling of empty values, e.g. author:ignore,isbn:match (modes: ignore, match, reject)")
+	flag.Parse()
+
+	switch cfg.TrailingSlash {
+	case slashOff, slashRedirect, slashStrip:
+	default:
+		return fmt.Errorf("invalid -trailing-slash %q: must be off, redirect or strip", cfg.TrailingSlash)
+	}
+
+	if cfg.JSONNaming != namingSnake && cfg.JSONNaming != namingCamel {
+		return fmt.Errorf("invalid -json-naming %q: must be snake or camel", cfg.JSONNaming)
+	}
+
+	if cfg.ErrorFormat != errorsText && cfg.ErrorFormat != errorsProblem {
+		return fmt.Errorf("invalid -error-format %q: must be text or problem", cfg.ErrorFormat)
+	}
+
+	if cfg.AcceptCharset != charsetIgnore && cfg.AcceptCharset != charsetStrict {
+		return fmt.Errorf("invalid -accept-charset %q: must be ignore or strict", cfg.AcceptCharset)
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(cfg.DefaultAccept); err != nil || mediaType != "application/json" {
+		return fmt.Errorf("invalid -default-accept %q: must be application/json, optionally with parameters", cfg.DefaultAccept)
+	}
+
+	if err := applyEmptyFilterOverrides(*emptyFilters); err != nil {
+		return err
+	}
+
+	var err error
+	if cfg.Indexes, err = parseIndexList(*indexes); err != nil {
+		return err
+	}
+	if cfg.Deprecations, err = parseDeprecations(deprecated); err != nil {
+		return err
+	}
+	if cfg.CreateDefaults, err = parseCreateDefaults(*createDefaults); err != nil {
+		return err
+	}
+	if cfg.ExpandAllowed, err = parseExpandList(*expand); err != nil {
+		return err
+	}
+	if cfg.MaxExpand < 0 {
+		return fmt.Errorf("invalid -max-expand %d: must not be negative", cfg.MaxExpand)
+	}
+
+	if cfg.MaxPageSize < 1 || cfg.DefaultPageSize < 0 || cfg.DefaultPageSize > cfg.MaxPageSize {
+		return fmt.Errorf("invalid page sizes: need 0 <= -default-page-size <= -max-page-size and -max-page-size >= 1")
+	}
+
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return fmt.Errorf("invalid TLS settings: -tls-cert and -tls-key must be given together")
+	}
+	if cfg.HTTPRedirectPort != "" && cfg.TLSCert == "" {
+		return fmt.Errorf("invalid -http-redirect-port: redirecting to HTTPS needs -tls-cert and -tls-key")
+	}
+	if cfg.HSTSMaxAge < 0 {
+		return fmt.Errorf("invalid -hsts-max-age %s: must not be negative", cfg.HSTSMaxAge)
+	}
+
+	if cfg.DrainDelay < 0 || cfg.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid shutdown settings: need -drain-delay >= 0 and a positive -shutdown-timeout")
+	}
+
+	if cfg.StatsBudget <= 0 {
+		return fmt.Errorf("invalid -stats-budget %s: must be positive", cfg.StatsBudget)
+	}
+
+	if cfg.FeedSize < 1 || cfg.FeedSize > 1000 {
+		return fmt.Errorf("invalid -feed-size %d: must be between 1 and 1000", cfg.FeedSize)
+	}
+	if cfg.PublicBaseURL != "" {
+		u, err := url.Parse(cfg.PublicBaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("invalid -public-base-url %q: want a scheme and host such as https://books.example.com", cfg.PublicBaseURL)
+		}
+		cfg.PublicBaseURL = u.Scheme + "://" + u.Host
+	}
+
+	if cfg.StatsTotals < 0 {
+		return fmt.Errorf("invalid -stats-totals %s: must not be negative", cfg.StatsTotals)
+	}
+
+	if cfg.ReadRetries < 0 || cfg.ReadRetries > 5 {
+		return fmt.Errorf("invalid -read-retries %d: must be between 0 and 5", cfg.ReadRetries)
+	}
+
+	if cfg.TrashRetention < 0 || cfg.PurgeInterval <= 0 {
+		return fmt.Errorf("invalid trash purge settings: need -trash-retention >= 0 and a positive -purge-interval")
+	}
+
+	if cfg.BreakerThreshold < 0 || cfg.BreakerCooldown <= 0 {
+		return fmt.Errorf("invalid breaker settings: need -breaker-threshold >= 0 and a positive -breaker-cooldown")
+	}
+
+	// Migrations need a second, environment-level opt-in so a stray flag in a
+	// production command line cannot alter the Azure SQL schema.
+	cfg.AllowMigrate = os.Getenv("ALLOW_MIGRATE") == "true"
+
+	cfg.DBHost = envOr("DB_HOST", "project-sql-server1.database.windows.net")
+	cfg.DBPort = envOr("DB_PORT", "1433")
+	cfg.DBName = envOr("DB_NAME", "projectdb")
+	cfg.DBUser = envOr("DB_USER", "azureuser")
+	cfg.DBReadHost = os.Getenv("DB_READ_HOST")
+	cfg.DBAppName = envOr("DB_APP_NAME", "mysystem-books-api")
+	switch intent := os.Getenv("DB_APPLICATION_INTENT"); strings.ToLower(intent) {
+	case "":
+	case "readwrite":
+		cfg.DBApplicationIntent = "ReadWrite"
+	case "readonly":
+		cfg.DBApplicationIntent = "ReadOnly"
+	default:
+		return fmt.Errorf("invalid DB_APPLICATION_INTENT %q: must be ReadWrite or ReadOnly", intent)
+	}
+	cfg.KeyVaultURL = envOr("KEY_VAULT_URL", "https://sqlkeyvaultdb.vault.azure.net/")
+	cfg.KeyVaultSecret = envOr("KEY_VAULT_SECRET", "sqlkeysecretdb")
+	cfg.KeyVaultDSNSecret = os.Getenv("KEY_VAULT_DSN_SECRET")
+
+	// Secrets come from the environment so they don't show up in process listings.
+	cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	if cfg.RegularMaxBody, err = envBytes("REGULAR_MAX_BODY", defaultRegularMaxBody); err != nil {
+		return err
+	}
+	if cfg.UploadMaxBody, err = envBytes("UPLOAD_MAX_BODY", defaultUploadMaxBody); err != nil {
+		return err
+	}
+	return nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// logConfig logs the effective configuration at startup so it is obvious
+// from the logs what an instance booted with. Secrets are never printed;
+// only whether they are set.
+func logConfig() {
+	log.Printf("INFO config: port=%s h2c=%t tls=%t http_redirect_port=%q hsts_max_age=%s drain_delay=%s shutdown_timeout=%s db_driver=sqlserver db_host=%s db_port=%s db_name=%s db_user=%s db_app_name=%q db_application_intent=%q db_read_host=%q key_vault_url=%s key_vault_secret=%s key_vault_dsn_secret=%q",
+		cfg.Port, cfg.H2C, cfg.TLSCert != "", cfg.HTTPRedirectPort, cfg.HSTSMaxAge, cfg.DrainDelay, cfg.ShutdownTimeout, cfg.DBHost, cfg.DBPort, cfg.DBName, cfg.DBUser, cfg.DBAppName, cfg.DBApplicationIntent, cfg.DBReadHost, cfg.KeyVaultURL, cfg.KeyVaultSecret, cfg.KeyVaultDSNSecret)
+	log.Printf("INFO config: default_page_size=%d max_page_size=%d feed_size=%d public_base_url=%q expand=%s max_expand=%d regular_max_body=%d upload_max_body=%d db_max_concurrent=%d db_queue_timeout=%s count_cache_ttl=%s cache_snapshot=%q stats_budget=%s stats_totals=%s read_retries=%d trash_retention=%s purge_interval=%s breaker_threshold=%d breaker_cooldown=%s",
+		cfg.DefaultPageSize, cfg.MaxPageSize, cfg.FeedSize, cfg.PublicBaseURL, strings.Join(cfg.ExpandAllowed, ","), cfg.MaxExpand, cfg.RegularMaxBody, cfg.UploadMaxBody, cfg.DBMaxConcurrent, cfg.DBQueueTimeout, cfg.CountCacheTTL, cfg.CacheSnapshot,
+		cfg.StatsBudget, cfg.StatsTotals, cfg.ReadRetries, cfg.TrashRetention, cfg.PurgeInterval, cfg.BreakerThreshold, cfg.BreakerCooldown)
+	log.Printf("INFO config: trailing_slash=%s json_naming=%s error_format=%s accept_charset=%s default_accept=%q content_language=%q debug=%t log_payloads=%t migrate=%t indexes=%s deprecated_routes=%d allow_migrate=%t allow_env_password=%t admin_token=%s db_password_env=%s",
+		cfg.TrailingSlash, cfg.JSONNaming, cfg.ErrorFormat, cfg.AcceptCharset, cfg.DefaultAccept, cfg.ContentLanguage, cfg.Debug, cfg.LogPayloads, cfg.Migrate, strings.Join(cfg.Indexes, ","), len(cfg.Deprecations), cfg.AllowMigrate, cfg.AllowEnvPassword,
+		redacted(cfg.AdminToken), redacted(os.Getenv("DB_PASSWORD")))
+}
+
+// redacted describes a secret without revealing it.
+func redacted(secret string) string {
+	if secret == "" {
+		return "<unset>"
+	}
+	return "<redacted>"
+}
+
+// envBytes reads a positive byte count from the environment, or returns def
+// when the variable is unset.
+func envBytes(key string, def int64) (int64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive number of bytes", key, v)
+	}
+	return n, nil
+}
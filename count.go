@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// countCache remembers COUNT(*) results per filter for a short TTL, so the
+// count endpoint and the list envelope do not scan the table on every call.
+// Any committed or attempted write to books drops every entry; a read racing
+// a write can still cache the old figure, but only until the TTL expires.
+type countCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]countEntry
+	// hits counts lookups per key since startup, for snapshotting the
+	// hottest keys; it survives Flush and tracks up to maxTrackedCountKeys.
+	hits map[string]int64
+}
+
+const maxTrackedCountKeys = 10000
+
+type countEntry struct {
+	count   int64
+	expires time.Time
+}
+
+var bookCounts *countCache
+
+func newCountCache(ttl time.Duration) *countCache {
+	return &countCache{ttl: ttl, entries: map[string]countEntry{}, hits: map[string]int64{}}
+}
+
+func (c *countCache) get(key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, tracked := c.hits[key]; tracked || len(c.hits) < maxTrackedCountKeys {
+		c.hits[key]++
+	}
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return 0, false
+	}
+	return e.count, true
+}
+
+func (c *countCache) put(key string, count int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = countEntry{count: count, expires: time.Now().Add(c.ttl)}
+}
+
+// restore caches a count recomputed from a snapshot, crediting key with at
+// least hits lookups.
+func (c *countCache) restore(key string, count, hits int64) {
+	c.put(key, count)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits[key] = max(c.hits[key], hits)
+}
+
+func (c *countCache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = map[string]countEntry{}
+	return n
+}
+
+// Warm caches the unfiltered total, the count most callers ask for.
+func (c *countCache) Warm(ctx context.Context) error {
+	var total int64
+	if err := DB.WithContext(ctx).Model(&Book{}).Count(&total).Error; err != nil {
+		return err
+	}
+	c.put(BookQuery{}.Key(), total)
+	return nil
+}
+
+// hottest returns up to n keys, most looked-up first.
+func (c *countCache) hottest(n int) []string {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.hits))
+	for k := range c.hits {
+		keys = append(keys, k)
+	}
+	hits := maps.Clone(c.hits)
+	c.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if hits[keys[i]] != hits[keys[j]] {
+			return hits[keys[i]] > hits[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys[:min(n, len(keys))]
+}
+
+// invalidateOnWrite registers GORM callbacks that flush the cache after any
+// create, update or delete on the books table, however the write was issued.
+func (c *countCache) invalidateOnWrite(db *gorm.DB) error {
+	flush := func(tx *gorm.DB) {
+		if tx.Statement.Table == "books" {
+			c.Flush()
+		}
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("count_cache:create", flush); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("count_cache:update", flush); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("count_cache:delete", flush)
+}
+
+// countBooks counts the books matched by bq. ?fresh=true bypasses the cache
+// and refreshes it. While caching, misses are counted on the primary: the
+// cache is emptied by every write, and refilling it from a lagging replica
+// would pin the pre-write count for the whole TTL.
+func countBooks(r *http.Request, bq BookQuery) (int64, error) {
+	fresh := r.URL.Query().Get("fresh") == "true"
+	if bookCounts != nil && !fresh {
+		if n, ok := bookCounts.get(bq.Key()); ok {
+			return n, nil
+		}
+	}
+	var total int64
+	if bookCounts != nil {
+		if err := bq.Apply(dbFor(r)).Count(&total).Error; err != nil {
+			return 0, err
+		}
+		bookCounts.put(bq.Key(), total)
+		return total, nil
+	}
+	err := readWithFallback(r, func(db *gorm.DB) error {
+		return bq.Apply(db).Count(&total).Error
+	})
+	return total, err
+}
+
+// CountBooks serves GET /books/count with the same filters as GetBooks.
+func CountBooks(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+	total, err := countBooks(r, bq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]int64{"count": total})
+}
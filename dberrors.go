@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sync"
+
+	mssql "github.com/microsoft/go-mssqldb"
+	"gorm.io/gorm/schema"
+)
+
+// transientSQLErrors are the Azure SQL error numbers Microsoft documents as
+// transient: the database is briefly unavailable (failover, throttling,
+// reconfiguration) and the same statement may succeed if retried.
+var transientSQLErrors = map[int32]bool{
+	20:    true,
+	64:    true,
+	233:   true,
+	4060:  true,
+	4221:  true,
+	10053: true,
+	10054: true,
+	10060: true,
+	10928: true,
+	10929: true,
+	40143: true,
+	40197: true,
+	40501: true,
+	40540: true,
+	40613: true,
+	49918: true,
+	49919: true,
+	49920: true,
+}
+
+// loginFailed is reported when the credentials are rejected.
+const loginFailed = 18456
+
+// isTransientDBError reports whether err is a short-lived Azure SQL or
+// network failure that a retry may get past.
+func isTransientDBError(err error) bool {
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) {
+		return transientSQLErrors[sqlErr.Number]
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// isDBOutage reports whether err means the database could not be used at
+// all, as opposed to rejecting a particular statement (a constraint
+// violation, say, which proves the server is up).
+func isDBOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	var sqlErr mssql.Error
+	if errors.As(err, &sqlErr) && sqlErr.Number == loginFailed {
+		return true
+	}
+	return isTransientDBError(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// SQL Server errors raised when a write breaks a constraint. The messages
+// name the offending column (or the index or constraint, which
+// constraintColumns maps back to one).
+const (
+	sqlNotNull        = 515  // Cannot insert the value NULL into column 'x', ...
+	sqlConstraint     = 547  // The INSERT statement conflicted with the CHECK constraint "c". ... column 'x'.
+	sqlDuplicateIndex = 2601 // Cannot insert duplicate key row in object 'o' with unique index 'i'. The duplicate key value is (v).
+	sqlDuplicateKey   = 2627 // Violation of UNIQUE KEY constraint 'c'. ... The duplicate key value is (v).
+	sqlTruncated      = 2628 // String or binary data would be truncated in table 't', column 'x'. Truncated value: 'v'.
+)
+
+var (
+	sqlColumnName     = regexp.MustCompile(`column '([^']+)'`)
+	sqlIndexName      = regexp.MustCompile(`(?:unique index|constraint) ['"]([^'"]+)['"]`)
+	sqlDuplicateValue = regexp.MustCompile(`The duplicate key value is \((.*)\)`)
+)
+
+// constraintColumns maps index and constraint names to the column they
+// cover, for errors that only name the index.
+func constraintColumns() map[string]string {
+	m := map[string]string{}
+	for _, idx := range bookIndexes {
+		m[idx.index] = idx.column
+	}
+	return m
+}
+
+// constraintErrors turns a constraint violation into field errors, so a
+// write the database refuses gets a 422 that names the field rather than a
+// 500 with the driver's message. It returns nil for any other error, and
+// for violations it cannot tie to a column.
+func constraintErrors(err error) []fieldError {
+	var sqlErr mssql.Error
+	if !errors.As(err, &sqlErr) {
+		return nil
+	}
+	column := ""
+	if m := sqlColumnName.FindStringSubmatch(sqlErr.Message); m != nil {
+		column = m[1]
+	} else if m := sqlIndexName.FindStringSubmatch(sqlErr.Message); m != nil {
+		column = constraintColumns()[m[1]]
+	}
+	if column == "" {
+		return nil
+	}
+	var msg string
+	switch sqlErr.Number {
+	case sqlNotNull:
+		msg = "is required"
+	case sqlTruncated:
+		msg = "is too long"
+		if size := columnSize(column); size > 0 {
+			msg = fmt.Sprintf("must be at most %d characters", size)
+		}
+	case sqlDuplicateIndex, sqlDuplicateKey:
+		msg = "must be unique"
+		if m := sqlDuplicateValue.FindStringSubmatch(sqlErr.Message); m != nil {
+			msg += "; " + m[1] + " is already taken"
+		}
+	case sqlConstraint:
+		msg = "is not allowed"
+		if m := sqlIndexName.FindStringSubmatch(sqlErr.Message); m != nil {
+			msg += " by the " + m[1] + " constraint"
+		}
+	default:
+		return nil
+	}
+	return []fieldError{{Field: apiName(column), Message: msg}}
+}
+
+// columnSize is the size tag of a Book column, or 0 if it has none.
+func columnSize(column string) int {
+	s, err := schema.Parse(&Book{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return 0
+	}
+	if f := s.LookUpField(column); f != nil {
+		return f.Size
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// dbTestTimeout bounds a connection test, Key Vault lookup included.
+const dbTestTimeout = 15 * time.Second
+
+// dbTestRunning allows one connection test at a time.
+var dbTestRunning sync.Mutex
+
+// dbTestRequest picks the settings to test. At most one field may be set;
+// with none, the current settings are tested the way startup resolves them.
+type dbTestRequest struct {
+	// DSN is a complete connection string.
+	DSN string `json:"dsn"`
+	// DSNSecret names a Key Vault secret holding a connection string, as
+	// KEY_VAULT_DSN_SECRET would.
+	DSNSecret string `json:"dsn_secret"`
+	// PasswordSecret names a Key Vault secret holding the password for the
+	// DB_* settings, as KEY_VAULT_SECRET would.
+	PasswordSecret string `json:"password_secret"`
+}
+
+// dbTestResult reports a connection test. Server, Database and Login are
+// what the server says it is, to confirm the settings reach the intended
+// database; Stage says where a failed test stopped.
+type dbTestResult struct {
+	Source    string  `json:"source"`
+	Target    string  `json:"target,omitempty"`
+	OK        bool    `json:"ok"`
+	LatencyMS float64 `json:"latency_ms"`
+	Server    string  `json:"server,omitempty"`
+	Database  string  `json:"database,omitempty"`
+	Login     string  `json:"login,omitempty"`
+	Stage     string  `json:"stage,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// CheckDBConnection serves POST /admin/db/test. It opens a separate,
+// single-connection pool with the requested settings, logs in, asks the
+// server who it is and closes the pool again, leaving the live one alone.
+// The outcome is reported with a 200 either way; only a bad request or a
+// test already in progress get an error status. Credentials are neither
+// logged nor echoed: Target names only the host and database, and a
+// password is scrubbed from driver errors.
+func CheckDBConnection(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req dbTestRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+	set := 0
+	for _, v := range []string{req.DSN, req.DSNSecret, req.PasswordSecret} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		http.Error(w, "set at most one of dsn, dsn_secret and password_secret", http.StatusBadRequest)
+		return
+	}
+	if !dbTestRunning.TryLock() {
+		http.Error(w, "A connection test is already running", http.StatusTooManyRequests)
+		return
+	}
+	defer dbTestRunning.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), dbTestTimeout)
+	defer cancel()
+	res := dbTestResult{Source: "current"}
+	var dsn string
+	var err error
+	switch {
+	case req.DSN != "":
+		res.Source, dsn = "dsn", withConnectionOptions(req.DSN)
+	case req.DSNSecret != "":
+		res.Source = "dsn_secret"
+		if dsn, err = keyVaultSecret(ctx, req.DSNSecret); err == nil {
+			dsn = withConnectionOptions(dsn)
+		}
+	case req.PasswordSecret != "":
+		res.Source = "password_secret"
+		var password string
+		if password, err = keyVaultSecret(ctx, req.PasswordSecret); err == nil {
+			dsn = buildDSN(password)
+		}
+	default:
+		dsn, err = connectionDSN(ctx)
+	}
+	if err != nil {
+		res.Stage, res.Error = "key_vault", err.Error()
+		respondJSON(w, http.StatusOK, res)
+		return
+	}
+	respondJSON(w, http.StatusOK, testConnection(ctx, dsn, res))
+}
+
+// testConnection logs in with dsn and fills in res.
+func testConnection(ctx context.Context, dsn string, res dbTestResult) dbTestResult {
+	conn, err := msdsn.Parse(dsn)
+	if err != nil {
+		// The parse error may quote the connection string.
+		res.Stage, res.Error = "parse", "invalid connection string"
+		return res
+	}
+	res.Target = connectionTarget(conn)
+	fail := func(stage string, err error) dbTestResult {
+		res.Stage, res.Error = stage, scrubSecret(err.Error(), conn.Password)
+		return res
+	}
+
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		return fail("connect", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	start := time.Now()
+	if err := db.PingContext(ctx); err != nil {
+		res.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+		return fail("connect", err)
+	}
+	res.LatencyMS = float64(time.Since(start)) / float64(time.Millisecond)
+	err = db.QueryRowContext(ctx, "SELECT @@SERVERNAME, DB_NAME(), SUSER_SNAME()").Scan(&res.Server, &res.Database, &res.Login)
+	if err != nil {
+		return fail("query", err)
+	}
+	res.OK = true
+	return res
+}
+
+// connectionTarget names where conn points, without credentials.
+func connectionTarget(conn msdsn.Config) string {
+	host := conn.Host
+	if conn.Instance != "" {
+		host += `\` + conn.Instance
+	}
+	if conn.Port != 0 {
+		host = net.JoinHostPort(host, strconv.FormatUint(conn.Port, 10))
+	}
+	if conn.Database == "" {
+		return host
+	}
+	return fmt.Sprintf("%s/%s", host, conn.Database)
+}
+
+func scrubSecret(msg, secret string) string {
+	if secret == "" {
+		return msg
+	}
+	return strings.ReplaceAll(msg, secret, "[REDACTED]")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// defaultableFields are the fields -create-defaults may set. book_name and
+// isbn identify a book, so they never get a default.
+var defaultableFields = []string{"author", "price", "genre", "currency", "language", "stock"}
+
+// parseCreateDefaults parses -create-defaults, a comma-separated list of
+// field=value pairs such as currency=USD,genre=Uncategorized, into the book
+// CreateBook starts from. The defaults must pass validation themselves.
+func parseCreateDefaults(spec string) (Book, error) {
+	var b Book
+	if spec == "" {
+		return b, nil
+	}
+	set := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		field, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return Book{}, fmt.Errorf("invalid -create-defaults entry %q: want field=value", item)
+		}
+		var err error
+		switch field {
+		case "author":
+			b.Author = value
+		case "genre":
+			b.Genre = value
+		case "currency":
+			b.Currency = strings.ToUpper(value)
+		case "language":
+			b.Language = value
+		case "price":
+			b.Price, err = strconv.ParseFloat(value, 64)
+		case "stock":
+			b.Stock, err = strconv.Atoi(value)
+		default:
+			return Book{}, fmt.Errorf("invalid -create-defaults field %q: must be one of %s", field, strings.Join(defaultableFields, ", "))
+		}
+		if err != nil {
+			return Book{}, fmt.Errorf("invalid -create-defaults value %q for %s: not a number", value, field)
+		}
+		set[apiName(field)] = true
+	}
+	probe := b
+	probe.BookName = "probe" // the defaults never include the required title
+	for _, e := range validateBook(probe) {
+		if set[e.Field] {
+			return Book{}, fmt.Errorf("invalid -create-defaults value for %s: %s", e.Field, e.Message)
+		}
+	}
+	return b, nil
+}
+
+// decodeOverDefaults decodes a POST /books body over the -create-defaults.
+// Every field the body mentions replaces its default, null included: the
+// JSON decoder leaves a field alone on null, so those are zeroed here.
+func decodeOverDefaults(body json.RawMessage) (Book, error) {
+	book := cfg.CreateDefaults
+	if err := json.Unmarshal(body, &book); err != nil {
+		return Book{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return Book{}, err
+	}
+	for _, field := range defaultableFields {
+		if raw, ok := fields[field]; !ok || string(raw) != "null" {
+			continue
+		}
+		switch field {
+		case "author":
+			book.Author = ""
+		case "genre":
+			book.Genre = ""
+		case "currency":
+			book.Currency = ""
+		case "language":
+			book.Language = ""
+		case "price":
+			book.Price = 0
+		case "stock":
+			book.Stock = 0
+		}
+	}
+	return book, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCreateDefaults(t *testing.T) {
+	withConfig(t)
+	got, err := parseCreateDefaults("currency=usd, stock=0,genre=Uncategorized,price=9.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Currency != "USD" || got.Genre != "Uncategorized" || got.Price != 9.5 || got.Stock != 0 {
+		t.Errorf("parseCreateDefaults = %+v", got)
+	}
+	for spec, wantErr := range map[string]string{
+		"genre":           "want field=value",
+		"isbn=123":        "must be one of",
+		"book_name=x":     "must be one of",
+		"stock=lots":      "not a number",
+		"stock=-1":        "for stock",
+		"currency=dollar": "for currency",
+	} {
+		if _, err := parseCreateDefaults(spec); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("parseCreateDefaults(%q) error = %v, want one containing %q", spec, err, wantErr)
+		}
+	}
+}
+
+func TestDecodeOverDefaults(t *testing.T) {
+	withConfig(t)
+	var err error
+	if cfg.CreateDefaults, err = parseCreateDefaults("currency=USD,genre=Uncategorized,stock=3"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeOverDefaults([]byte(`{"book_name":"Dune","genre":null,"stock":null,"currency":"GBP"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BookName != "Dune" || got.Genre != "" || got.Stock != 0 || got.Currency != "GBP" {
+		t.Errorf("decodeOverDefaults = %+v, want null and set fields to replace the defaults", got)
+	}
+	if got, _ := decodeOverDefaults([]byte(`{"book_name":"Emma"}`)); got.Genre != "Uncategorized" || got.Stock != 3 {
+		t.Errorf("decodeOverDefaults = %+v, want the defaults for absent fields", got)
+	}
+	if _, err := decodeOverDefaults([]byte(`{"stock":"lots"}`)); err == nil {
+		t.Error("a mistyped field decoded without an error")
+	}
+}
+
+func TestCreateBookDefaults(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	var err error
+	if cfg.CreateDefaults, err = parseCreateDefaults("currency=USD,genre=Uncategorized"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		body, genre, currency string
+	}{
+		{`{"book_name":"Dune"}`, "Uncategorized", "USD"},
+		{`{"book_name":"Emma","genre":"Classics","currency":"GBP"}`, "Classics", "GBP"},
+		{`{"book_name":"Ulysses","genre":""}`, "", "USD"},
+		{`{"book_name":"Middlemarch","genre":null}`, "", "USD"},
+	} {
+		req := httptest.NewRequest("POST", "/books", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		CreateBook(rec, req)
+		if rec.Code != 200 {
+			t.Fatalf("%s: %d %s", tt.body, rec.Code, rec.Body)
+		}
+		var stored Book
+		if err := db.Order("id DESC").First(&stored).Error; err != nil {
+			t.Fatal(err)
+		}
+		if stored.Genre != tt.genre || stored.Currency != tt.currency {
+			t.Errorf("%s: stored genre %q, currency %q; want %q, %q", tt.body, stored.Genre, stored.Currency, tt.genre, tt.currency)
+		}
+		if want := `"currency":"` + tt.currency + `"`; !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: response %s lacks %s", tt.body, rec.Body, want)
+		}
+	}
+}
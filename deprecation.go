@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// deprecation is when a route was deprecated and, optionally, when it will
+// be removed.
+type deprecation struct {
+	Since  time.Time
+	Sunset time.Time // zero when no removal date is set
+}
+
+// repeatedFlag collects every value of a flag that may be given more than
+// once.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string { return strings.Join(*f, " ") }
+
+func (f *repeatedFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// parseDeprecations reads the -deprecated flags, one route-template=
+// since[/sunset] entry each with dates as YYYY-MM-DD, e.g.
+// -deprecated '/books=2026-01-01/2026-07-01' -deprecated
+// '/book/{id:[0-9]+}=2026-01-01'. Templates are written exactly as
+// registered in newRouter; as they may hold commas and '=' in their
+// patterns, each entry is a separate flag and the dates follow the last '='.
+func parseDeprecations(entries []string) (map[string]deprecation, error) {
+	deps := map[string]deprecation{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid -deprecated entry %q: want route=since[/sunset]", entry)
+		}
+		tmpl, dates := entry[:i], entry[i+1:]
+		since, sunset, hasSunset := strings.Cut(dates, "/")
+		var dep deprecation
+		var err error
+		if dep.Since, err = time.Parse(time.DateOnly, since); err != nil {
+			return nil, fmt.Errorf("invalid -deprecated date %q for %s: want YYYY-MM-DD", since, tmpl)
+		}
+		if hasSunset {
+			if dep.Sunset, err = time.Parse(time.DateOnly, sunset); err != nil {
+				return nil, fmt.Errorf("invalid -deprecated sunset %q for %s: want YYYY-MM-DD", sunset, tmpl)
+			}
+			if dep.Sunset.Before(dep.Since) {
+				return nil, fmt.Errorf("invalid -deprecated entry for %s: sunset is before the deprecation date", tmpl)
+			}
+		}
+		deps[tmpl] = dep
+	}
+	return deps, nil
+}
+
+// markDeprecated adds the Deprecation (RFC 9745) and Sunset (RFC 8594)
+// headers to responses from routes listed in -deprecated, and logs each call
+// so we can see who still uses a route before it is removed.
+func markDeprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tmpl, err := route.GetPathTemplate()
+		dep, ok := cfg.Deprecations[tmpl]
+		if err != nil || !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(dep.Since.Unix(), 10))
+		if !dep.Sunset.IsZero() {
+			w.Header().Set("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+		}
+		log.Printf("INFO deprecated route called: %s %s from %s (User-Agent %q)", r.Method, tmpl, r.RemoteAddr, r.UserAgent())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// warnUnknownDeprecations logs -deprecated entries that match no route, which
+// would otherwise be ignored silently.
+func warnUnknownDeprecations(router *mux.Router) {
+	registered := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			registered[tmpl] = true
+		}
+		return nil
+	})
+	for tmpl := range cfg.Deprecations {
+		if !registered[tmpl] {
+			log.Printf("WARNING: -deprecated lists %s, which is not a registered route", tmpl)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseDeprecations(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+	tests := []struct {
+		entries []string
+		want    map[string]deprecation
+		wantErr bool
+	}{
+		{nil, map[string]deprecation{}, false},
+		{[]string{"/books=2026-01-01/2026-07-01"},
+			map[string]deprecation{"/books": {Since: day("2026-01-01"), Sunset: day("2026-07-01")}}, false},
+		{[]string{"/book/{id:[0-9]{1,4}}=2026-01-01", " /books/tree=2026-02-01 "},
+			map[string]deprecation{
+				"/book/{id:[0-9]{1,4}}": {Since: day("2026-01-01")},
+				"/books/tree":           {Since: day("2026-02-01")},
+			}, false},
+		{[]string{"/books"}, nil, true},
+		{[]string{"=2026-01-01"}, nil, true},
+		{[]string{"/books=01/02/2026"}, nil, true},
+		{[]string{"/books=2026-07-01/2026-01-01"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDeprecations(tt.entries)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDeprecations(%q) error = %v, wantErr %t", tt.entries, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseDeprecations(%q) = %v, want %v", tt.entries, got, tt.want)
+		}
+		for tmpl, dep := range tt.want {
+			if g, ok := got[tmpl]; !ok || !g.Since.Equal(dep.Since) || !g.Sunset.Equal(dep.Sunset) {
+				t.Errorf("parseDeprecations(%q)[%s] = %+v, want %+v", tt.entries, tmpl, g, dep)
+			}
+		}
+	}
+}
+
+func TestDeprecationHeadersOnBreakerRejection(t *testing.T) {
+	withConfig(t)
+	saved := dbBreaker
+	t.Cleanup(func() { dbBreaker = saved })
+	dbBreaker = newCircuitBreaker(1, time.Minute)
+	dbBreaker.record(driver.ErrBadConn)
+	var err error
+	if cfg.Deprecations, err = parseDeprecations([]string{"/books=2026-01-01/2026-07-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest("GET", "/books", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503 from the open breaker", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") == "" || rec.Header().Get("Sunset") == "" {
+		t.Errorf("503 from a deprecated route lacks Deprecation/Sunset: %v", rec.Header())
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestBuildDSNConnectionOptions(t *testing.T) {
+	withConfig(t)
+	cfg.DBUser, cfg.DBHost, cfg.DBPort, cfg.DBName = "app", "db.example.net", "1433", "books"
+	cfg.DBAppName, cfg.DBApplicationIntent = "books-api", "ReadWrite"
+
+	u, err := url.Parse(buildDSN("p@ss/word"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("app name") != "books-api" || q.Get("ApplicationIntent") != "ReadWrite" || q.Get("database") != "books" {
+		t.Errorf("query = %v, want the app name, intent and database", q)
+	}
+	if pw, _ := u.User.Password(); pw != "p@ss/word" {
+		t.Errorf("password = %q after escaping", pw)
+	}
+
+	cfg.DBReadHost = "replica.example.net"
+	replica, err := replicaDSN(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rq := mustQuery(t, replica); rq.Get("ApplicationIntent") != "ReadOnly" || rq.Get("app name") != "books-api" {
+		t.Errorf("replica query = %v, want ReadOnly intent and the same app name", rq)
+	}
+}
+
+func TestWithConnectionOptionsKeepsExplicitValues(t *testing.T) {
+	withConfig(t)
+	cfg.DBAppName, cfg.DBApplicationIntent = "books-api", "ReadWrite"
+	q := mustQuery(t, withConnectionOptions("sqlserver://u:p@h:1433?database=x&app+name=etl&ApplicationIntent=ReadOnly"))
+	if q.Get("app name") != "etl" || q.Get("ApplicationIntent") != "ReadOnly" {
+		t.Errorf("query = %v, want the secret's own values kept", q)
+	}
+	ado := "server=h;user id=u;password=p;database=x"
+	if got := withConnectionOptions(ado); got != ado {
+		t.Errorf("ADO-style DSN rewritten to %q", got)
+	}
+}
+
+func mustQuery(t *testing.T, dsn string) url.Values {
+	t.Helper()
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExpand(t *testing.T) {
+	withConfig(t)
+	tests := []struct {
+		spec    string
+		allowed []string
+		max     int
+		want    []string
+		wantErr string
+	}{
+		{"", []string{"reviews"}, 1, nil, ""},
+		{"reviews", []string{"reviews"}, 1, []string{"Reviews"}, ""},
+		{" reviews ,reviews,", []string{"reviews"}, 1, []string{"Reviews"}, ""},
+		{"reviews,tags", []string{"reviews"}, 1, nil, "must be one of reviews"},
+		{"Reviews", []string{"reviews"}, 1, nil, "must be one of reviews"},
+		{"reviews.book", []string{"reviews"}, 1, nil, "nested expands are not supported"},
+		{"reviews", nil, 1, nil, "expanding is disabled"},
+		{"reviews", []string{"reviews"}, 0, nil, "at most 0 relations"},
+	}
+	for _, tt := range tests {
+		cfg.ExpandAllowed, cfg.MaxExpand = tt.allowed, tt.max
+		got, err := parseExpand(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseExpand(%q) error = %v, want one containing %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseExpand(%q) = %q, %v; want %q", tt.spec, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseExpandList(t *testing.T) {
+	if got, err := parseExpandList(" reviews, ,reviews"); err != nil || !reflect.DeepEqual(got, []string{"reviews"}) {
+		t.Errorf("parseExpandList = %q, %v; want [reviews]", got, err)
+	}
+	if got, err := parseExpandList(""); err != nil || len(got) != 0 {
+		t.Errorf("parseExpandList(\"\") = %q, %v; want none", got, err)
+	}
+	if _, err := parseExpandList("reviews,author"); err == nil {
+		t.Error("parseExpandList accepted the unknown relation author")
+	}
+}
+
+func TestGetBookExpandReviews(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	book := Book{BookName: "Dune"}
+	if err := db.Create(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&[]Review{{BookID: book.ID, Rating: 5}, {BookID: book.ID, Rating: 3}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	flat := get(fmt.Sprintf("/book/%d", book.ID))
+	var plain map[string]interface{}
+	json.Unmarshal(flat.Body.Bytes(), &plain)
+	if _, ok := plain["reviews"]; ok {
+		t.Errorf("flat book has reviews: %s", flat.Body)
+	}
+
+	rec := get(fmt.Sprintf("/book/%d?expand=reviews", book.ID))
+	var got expandedBook
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	if got.BookName != "Dune" || len(got.Reviews) != 2 || got.Reviews[0].Rating != 5 {
+		t.Errorf("expanded book = %+v", got)
+	}
+	if rec.Header().Get("ETag") == flat.Header().Get("ETag") {
+		t.Errorf("expanded and flat books share ETag %s", rec.Header().Get("ETag"))
+	}
+	if rec := get(fmt.Sprintf("/book/%d?expand=tags", book.ID)); rec.Code != http.StatusBadRequest {
+		t.Errorf("expand=tags: %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type queryPlan struct {
+	Query string   `json:"query"`
+	Plan  []string `json:"plan"`
+}
+
+// explainBooks answers GetBooks?explain=true with the SQL Server estimated
+// plan for the list query instead of its results. The query is compiled with
+// SHOWPLAN_TEXT on, so it is never executed. Only admins may use it, and only
+// when the server was started with -debug.
+func explainBooks(w http.ResponseWriter, r *http.Request, bq BookQuery) {
+	if !cfg.Debug {
+		http.Error(w, "Query plans are only available when the server runs with -debug", http.StatusForbidden)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	query := DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var books []Book
+		return bq.Paginate(bq.Apply(tx)).Find(&books)
+	})
+
+	plan := queryPlan{Query: query, Plan: []string{}}
+	// SHOWPLAN is a session setting, so every statement must run on the same
+	// pooled connection.
+	err := DB.WithContext(r.Context()).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SET SHOWPLAN_TEXT ON").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SET SHOWPLAN_TEXT OFF")
+
+		rows, err := conn.Raw(query).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		// The first result set echoes the statement, the second holds the plan.
+		for {
+			for rows.Next() {
+				var line string
+				if err := rows.Scan(&line); err != nil {
+					return err
+				}
+				plan.Plan = append(plan.Plan, line)
+			}
+			if !rows.NextResultSet() {
+				break
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, plan)
+}
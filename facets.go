@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// distinctColumns maps the fields GetDistinct accepts to their columns.
+// Only these are allowed so the path segment never reaches SQL unchecked.
+var distinctColumns = map[string]string{
+	"author":   "author",
+	"genre":    "genre",
+	"currency": "currency",
+}
+
+type distinctValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// GetDistinct returns each distinct value of an allowlisted field with the
+// number of books that have it, for building filter dropdowns. Missing values
+// are reported as "". GROUP BY gives the same set as SELECT DISTINCT while
+// also producing the counts. If the query outlasts -stats-budget the list is
+// empty and the response carries X-Partial: true.
+func GetDistinct(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+	field := mux.Vars(r)["field"]
+	column, ok := distinctColumns[field]
+	if !ok {
+		http.Error(w, "Unsupported field: must be one of author, genre, currency", http.StatusBadRequest)
+		return
+	}
+
+	expr := "COALESCE(" + column + ", '')"
+	ctx, cancel := statsContext(r)
+	defer cancel()
+	var values []distinctValue
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		values = []distinctValue{}
+		return bq.Apply(db.WithContext(ctx)).
+			Select(expr + " AS value, COUNT(*) AS count").
+			Group(expr).
+			Order(expr).
+			Scan(&values).Error
+	})
+	if err != nil && ctx.Err() != nil {
+		if r.Context().Err() != nil {
+			return // the client is gone
+		}
+		w.Header().Set("X-Partial", "true")
+		respondJSON(w, http.StatusOK, []distinctValue{})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, values)
+}
+
+// defaultPriceTierBounds are used when GetPriceTiers gets no ?bounds=.
+var defaultPriceTierBounds = []float64{10, 25, 50}
+
+// maxPriceTierBounds keeps the generated SELECT list to a sane size.
+const maxPriceTierBounds = 20
+
+type priceTier struct {
+	Label string   `json:"label"`
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count *int64   `json:"count"`
+}
+
+// GetPriceTiers counts books per price tier. Tier boundaries come from
+// ?bounds=10,25,50 (ascending), which yields the tiers 0-10, 10-25, 25-50
+// and 50+; each tier includes its lower bound and excludes its upper one.
+// All tiers are counted in a single query with one CASE expression each; if
+// it outlasts -stats-budget the counts are null and the response carries
+// X-Partial: true.
+func GetPriceTiers(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+	bounds, err := parsePriceTierBounds(r.URL.Query().Get("bounds"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tiers := make([]priceTier, 0, len(bounds)+1)
+	exprs := make([]string, 0, len(bounds)+1)
+	var args []interface{}
+	lower := 0.0
+	for _, upper := range bounds {
+		upper := upper
+		tiers = append(tiers, priceTier{Label: formatPrice(lower) + "-" + formatPrice(upper), Min: lower, Max: &upper})
+		exprs = append(exprs, "COUNT(CASE WHEN price >= ? AND price < ? THEN 1 END)")
+		args = append(args, lower, upper)
+		lower = upper
+	}
+	tiers = append(tiers, priceTier{Label: formatPrice(lower) + "+", Min: lower})
+	exprs = append(exprs, "COUNT(CASE WHEN price >= ? THEN 1 END)")
+	args = append(args, lower)
+
+	counts := make([]int64, len(tiers))
+	dest := make([]interface{}, len(tiers))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	ctx, cancel := statsContext(r)
+	defer cancel()
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		return bq.Apply(db.WithContext(ctx)).Select(strings.Join(exprs, ", "), args...).Row().Scan(dest...)
+	})
+	if err != nil && ctx.Err() != nil {
+		if r.Context().Err() != nil {
+			return // the client is gone
+		}
+		w.Header().Set("X-Partial", "true")
+		respondJSON(w, http.StatusOK, tiers)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range tiers {
+		tiers[i].Count = &counts[i]
+	}
+	respondJSON(w, http.StatusOK, tiers)
+}
+
+func parsePriceTierBounds(s string) ([]float64, error) {
+	if s == "" {
+		return defaultPriceTierBounds, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > maxPriceTierBounds {
+		return nil, fmt.Errorf("at most %d bounds are allowed", maxPriceTierBounds)
+	}
+	bounds := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v <= 0 || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("invalid bound %q: must be a positive number", p)
+		}
+		if i > 0 && v <= bounds[i-1] {
+			return nil, errors.New("bounds must be strictly ascending")
+		}
+		bounds[i] = v
+	}
+	return bounds, nil
+}
+
+func formatPrice(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDistinctPartialPastBudget(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	DB = dryRunDB(t)
+	cfg.StatsBudget = time.Nanosecond
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/books/distinct/genre", nil), map[string]string{"field": "genre"})
+	rec := httptest.NewRecorder()
+	GetDistinct(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Partial") != "true" {
+		t.Errorf("status %d, X-Partial %q; want 200 and true", rec.Code, rec.Header().Get("X-Partial"))
+	}
+	if got := canonicalJSON(t, rec.Body.String()); got != "[]" {
+		t.Errorf("body %s, want []", got)
+	}
+}
+
+func TestPriceTiersPartialPastBudget(t *testing.T) {
+	withConfig(t)
+	testDB(t)
+	cfg.StatsBudget = time.Nanosecond
+
+	rec := httptest.NewRecorder()
+	GetPriceTiers(rec, httptest.NewRequest("GET", "/books/price-tiers?bounds=10", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Partial") != "true" {
+		t.Errorf("status %d, X-Partial %q; want 200 and true", rec.Code, rec.Header().Get("X-Partial"))
+	}
+	want := canonicalJSON(t, `[{"label":"0-10","min":0,"max":10,"count":null},{"label":"10+","min":10,"count":null}]`)
+	if got := canonicalJSON(t, rec.Body.String()); got != want {
+		t.Errorf("body %s, want %s", got, want)
+	}
+}
+
+// canonicalJSON re-encodes s so bodies compare regardless of key order.
+func canonicalJSON(t *testing.T, s string) string {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
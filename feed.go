@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const contentTypeAtom = "application/atom+xml; charset=utf-8"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Link      atomLink    `xml:"link"`
+	Summary   string      `xml:"summary,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// GetFeed serves GET /books/feed.atom: an Atom feed of the -feed-size most
+// recently added books, narrowed by the usual filters (?genre=SF follows
+// new science fiction). Each entry's id is the book's URL, which stays the
+// same when the book is edited; its updated timestamp is the book's, so
+// readers show edits as updates rather than new items. The feed carries the
+// list's ETag and Last-Modified, and readers polling with them get a 304.
+func GetFeed(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted {
+		http.Error(w, "include_deleted is not supported by the feed", http.StatusBadRequest)
+		return
+	}
+
+	var version collectionVersion
+	err = readWithFallback(r, func(db *gorm.DB) (err error) {
+		version, err = loadCollectionVersion(db, bq)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if writeCollectionValidators(w, r, version) {
+		return
+	}
+
+	var books []Book
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		books = nil
+		return bq.Apply(db).Order("created_at DESC, id DESC").Limit(cfg.FeedSize).Find(&books).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := xml.MarshalIndent(buildFeed(r, books, version.lastModified()), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeAtom)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+// buildFeed turns books, newest first, into a feed last changed at updated.
+func buildFeed(r *http.Request, books []Book, updated time.Time) atomFeed {
+	base := feedBaseURL()
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed := atomFeed{
+		ID:      base + "/books/feed.atom",
+		Title:   "New arrivals",
+		Updated: atomTime(updated),
+		Author:  atomPerson{Name: "Books API"},
+		Links:   []atomLink{{Rel: "self", Type: "application/atom+xml", Href: base + r.URL.RequestURI()}},
+		Entries: []atomEntry{},
+	}
+	for _, b := range books {
+		href := base + "/book/" + strconv.FormatUint(uint64(b.ID), 10)
+		entry := atomEntry{
+			ID:        href,
+			Title:     b.BookName,
+			Updated:   atomTime(b.UpdatedAt),
+			Published: atomTime(b.CreatedAt),
+			Link:      atomLink{Rel: "alternate", Type: "application/json", Href: href},
+			Summary:   feedSummary(b),
+		}
+		if b.Author != "" {
+			entry.Author = &atomPerson{Name: b.Author}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+// feedSummary describes a book in one line, e.g. "Herbert · SF · 9.50 USD".
+func feedSummary(b Book) string {
+	var parts []string
+	for _, s := range []string{b.Author, b.Genre} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if b.Price > 0 {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("%.2f %s", b.Price, b.Currency)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// feedBaseURL is the scheme and host links in the feed start with: the
+// configured -public-base-url, or else this instance's own listener. The
+// request's Host and X-Forwarded-Proto are never used, so a client cannot
+// plant links to another site in a feed that caches and readers share.
+func feedBaseURL() string {
+	if cfg.PublicBaseURL != "" {
+		return cfg.PublicBaseURL
+	}
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort("localhost", cfg.Port)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestBuildFeed(t *testing.T) {
+	withConfig(t)
+	cfg.PublicBaseURL = "https://books.example"
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	books := []Book{
+		{Model: gorm.Model{ID: 2, CreatedAt: created, UpdatedAt: created.Add(time.Hour)}, BookName: "Dune", Author: "Herbert", Genre: "SF", Price: 9.5, Currency: "USD"},
+		{Model: gorm.Model{ID: 1, CreatedAt: created, UpdatedAt: created}, BookName: "Anonymous"},
+	}
+	// Links ignore the Host and X-Forwarded-Proto the client sent.
+	req := httptest.NewRequest("GET", "http://attacker.example/books/feed.atom?genre=SF", nil)
+	req.Header.Set("X-Forwarded-Proto", "http")
+
+	data, err := xml.Marshal(buildFeed(req, books, created.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.XMLName.Space != "http://www.w3.org/2005/Atom" || feed.Updated != "2024-05-01T13:00:00Z" {
+		t.Errorf("feed namespace %q, updated %s", feed.XMLName.Space, feed.Updated)
+	}
+	if len(feed.Links) != 1 || feed.Links[0].Href != "https://books.example/books/feed.atom?genre=SF" {
+		t.Errorf("self link = %+v, want the request URI on -public-base-url", feed.Links)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(feed.Entries))
+	}
+	dune := feed.Entries[0]
+	if dune.ID != "https://books.example/book/2" || dune.Link.Href != dune.ID {
+		t.Errorf("entry id %s, link %s; want both to be the book's URL", dune.ID, dune.Link.Href)
+	}
+	if dune.Published != "2024-05-01T12:00:00Z" || dune.Updated != "2024-05-01T13:00:00Z" {
+		t.Errorf("entry published %s, updated %s", dune.Published, dune.Updated)
+	}
+	if dune.Summary != "Herbert · SF · 9.50 USD" || dune.Author == nil || dune.Author.Name != "Herbert" {
+		t.Errorf("entry summary %q, author %+v", dune.Summary, dune.Author)
+	}
+	if feed.Entries[1].Author != nil || strings.Contains(string(data), "<summary></summary>") {
+		t.Errorf("book without author or details: %s", data)
+	}
+}
+
+func TestFeedBaseURLFallsBackToListener(t *testing.T) {
+	withConfig(t)
+	cfg.Port = "8443"
+	if got := feedBaseURL(); got != "http://localhost:8443" {
+		t.Errorf("feedBaseURL = %s, want http://localhost:8443", got)
+	}
+	cfg.TLSCert = "cert.pem"
+	if got := feedBaseURL(); got != "https://localhost:8443" {
+		t.Errorf("feedBaseURL with TLS = %s, want https://localhost:8443", got)
+	}
+}
+
+func TestFeedRejectsIncludeDeleted(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	DB = dryRunDB(t)
+
+	rec := httptest.NewRecorder()
+	GetFeed(rec, httptest.NewRequest("GET", "/books/feed.atom?include_deleted=true", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestFeedListsNewestBooks(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.FeedSize = 2
+	for _, name := range []string{"First", "Second", "Third"} {
+		if err := db.Create(&Book{BookName: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	GetFeed(rec, httptest.NewRequest("GET", "/books/feed.atom", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != contentTypeAtom {
+		t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Entries) != 2 || feed.Entries[0].Title != "Third" || feed.Entries[1].Title != "Second" {
+		t.Errorf("entries = %+v, want Third and Second", feed.Entries)
+	}
+
+	req := httptest.NewRequest("GET", "/books/feed.atom", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	again := httptest.NewRecorder()
+	GetFeed(again, req)
+	if again.Code != http.StatusNotModified {
+		t.Errorf("poll with the current ETag: %d, want 304", again.Code)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Duplicate-ISBN policies accepted by ImportBooks' ?on_duplicate=.
+const (
+	duplicateError  = "error"  // any duplicate fails the whole import
+	duplicateSkip   = "skip"   // duplicate rows are ignored
+	duplicateUpdate = "update" // duplicate rows overwrite the existing book
+)
+
+// Row outcomes reported by ImportBooks.
+const (
+	rowCreated   = "created"
+	rowUpdated   = "updated"
+	rowSkipped   = "skipped"
+	rowDuplicate = "duplicate"
+	rowInvalid   = "invalid"
+	rowFailed    = "failed" // the database rejected the row
+)
+
+// importColumns are the CSV header names ImportBooks understands. They match
+// the JSON field names; book_name is the only required column.
+var importColumns = map[string]bool{
+	"book_name": true,
+	"author":    true,
+	"price":     true,
+	"genre":     true,
+	"currency":  true,
+	"language":  true,
+	"isbn":      true,
+	"stock":     true,
+}
+
+type importRow struct {
+	Row    int          `json:"row"`
+	ISBN   string       `json:"isbn,omitempty"`
+	Status string       `json:"status"`
+	ID     uint         `json:"id,omitempty"`
+	Errors []fieldError `json:"errors,omitempty"`
+	Error  string       `json:"error,omitempty"`
+
+	book    Book
+	columns map[string]bool
+}
+
+type importResult struct {
+	Policy    string      `json:"policy"`
+	Committed bool        `json:"committed"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Skipped   int         `json:"skipped"`
+	Rows      []importRow `json:"rows"`
+}
+
+var errImportRejected = errors.New("import rejected")
+
+// ImportBooks serves POST /books/import. The body is CSV with a header row
+// naming the columns; prices go through parsePriceIn, so supplier strings
+// such as "$1,299.00" are accepted, and a currency column settles
+// separators that are otherwise ambiguous ("1.299" with EUR is 1299). A row
+// is a duplicate when its ISBN matches an existing book or an earlier row,
+// and ?on_duplicate= decides what happens:
+//
+//   - error (default): nothing is written and the response is a 409;
+//   - skip: duplicate rows are left out, the rest are imported;
+//   - update: duplicate rows overwrite the existing book's imported columns.
+//
+// Every policy runs in a single transaction, and any invalid row rejects the
+// whole file with a 400, so an import is always all-or-nothing. Each invalid
+// row lists all of its field errors. A row the database refuses is marked
+// failed with the database's message (and the field, for a constraint
+// violation) and the import carries on checking the remaining rows before
+// rolling back with a 422, so every problem can be fixed in one pass.
+// Admin-only.
+func ImportBooks(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "text/csv" {
+		http.Error(w, "Content-Type must be text/csv", http.StatusUnsupportedMediaType)
+		return
+	}
+	policy := r.URL.Query().Get("on_duplicate")
+	if policy == "" {
+		policy = duplicateError
+	}
+	switch policy {
+	case duplicateError, duplicateSkip, duplicateUpdate:
+	default:
+		http.Error(w, "on_duplicate must be error, skip or update", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := readImportCSV(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res := importResult{Policy: policy, Rows: rows}
+	for _, row := range rows {
+		if row.Status == rowInvalid {
+			respondJSON(w, http.StatusBadRequest, res)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	err = dbFor(r).Transaction(func(tx *gorm.DB) error {
+		existing, err := booksByISBN(tx, rows)
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		failed := false
+		for i := range res.Rows {
+			row := &res.Rows[i]
+			if row.ISBN != "" && (existing[row.ISBN] != nil || seen[row.ISBN]) {
+				err = applyDuplicate(tx, policy, row, existing[row.ISBN])
+			} else if err = tx.Create(&row.book).Error; err == nil {
+				row.Status, row.ID = rowCreated, row.book.ID
+			}
+			if err != nil {
+				// An outage fails every later row too; stop at the first.
+				if isDBOutage(err) {
+					return err
+				}
+				row.Status, row.Error, row.ID = rowFailed, err.Error(), 0
+				row.Errors = constraintErrors(err)
+				failed = true
+				continue
+			}
+			if row.ISBN != "" {
+				seen[row.ISBN] = true
+				if existing[row.ISBN] == nil && row.ID != 0 {
+					existing[row.ISBN] = &row.book
+				}
+			}
+		}
+		if failed {
+			status = http.StatusUnprocessableEntity
+			return errImportRejected
+		}
+		for _, row := range res.Rows {
+			if row.Status == rowDuplicate {
+				status = http.StatusConflict
+				return errImportRejected
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportRejected) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Committed = err == nil
+	if res.Committed {
+		for _, row := range res.Rows {
+			switch row.Status {
+			case rowCreated:
+				res.Created++
+			case rowUpdated:
+				res.Updated++
+			case rowSkipped:
+				res.Skipped++
+			}
+		}
+	}
+	respondJSON(w, status, res)
+}
+
+// applyDuplicate handles a row whose ISBN is already taken according to the
+// policy. existing is nil when the clash is with an earlier row of the same
+// file that has not been stored yet.
+func applyDuplicate(tx *gorm.DB, policy string, row *importRow, existing *Book) error {
+	switch policy {
+	case duplicateSkip:
+		row.Status = rowSkipped
+		if existing != nil {
+			row.ID = existing.ID
+		}
+	case duplicateUpdate:
+		updates := map[string]interface{}{}
+		for column := range row.columns {
+			if column != "isbn" {
+				updates[column] = importValue(row.book, column)
+			}
+		}
+		if err := tx.Model(existing).Updates(updates).Error; err != nil {
+			return err
+		}
+		row.Status, row.ID = rowUpdated, existing.ID
+	default:
+		row.Status, row.Error = rowDuplicate, "a book with this ISBN already exists"
+		if existing != nil {
+			row.ID = existing.ID
+		}
+	}
+	return nil
+}
+
+func importValue(b Book, column string) interface{} {
+	switch column {
+	case "book_name":
+		return b.BookName
+	case "author":
+		return b.Author
+	case "price":
+		return b.Price
+	case "genre":
+		return b.Genre
+	case "currency":
+		return b.Currency
+	case "language":
+		return b.Language
+	case "stock":
+		return b.Stock
+	}
+	return nil
+}
+
+// booksByISBN loads the active books whose ISBN appears in rows. Lookups are
+// chunked to stay well under SQL Server's 2100 parameter limit.
+func booksByISBN(tx *gorm.DB, rows []importRow) (map[string]*Book, error) {
+	var isbns []string
+	for _, row := range rows {
+		if row.ISBN != "" {
+			isbns = append(isbns, row.ISBN)
+		}
+	}
+	found := map[string]*Book{}
+	const chunk = 1000
+	for start := 0; start < len(isbns); start += chunk {
+		end := min(start+chunk, len(isbns))
+		var books []Book
+		if err := tx.Where("isbn IN ?", isbns[start:end]).Find(&books).Error; err != nil {
+			return nil, err
+		}
+		for i := range books {
+			found[books[i].ISBN] = &books[i]
+		}
+	}
+	return found, nil
+}
+
+// readImportCSV parses the upload into rows. Rows that fail to parse are
+// returned with status invalid rather than as an error, so the client gets
+// every problem in one response.
+func readImportCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !importColumns[name] {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		index[name] = i
+	}
+	if _, ok := index["book_name"]; !ok {
+		return nil, errors.New("CSV must have a book_name column")
+	}
+
+	rows := []importRow{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, parseImportRecord(line, record, index))
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("CSV has no data rows")
+	}
+	return rows, nil
+}
+
+func parseImportRecord(line int, record []string, index map[string]int) importRow {
+	row := importRow{Row: line, columns: map[string]bool{}}
+	get := func(column string) string {
+		i, ok := index[column]
+		if !ok {
+			return ""
+		}
+		row.columns[column] = true
+		return strings.TrimSpace(record[i])
+	}
+	row.book = Book{
+		BookName: get("book_name"),
+		Author:   get("author"),
+		Genre:    get("genre"),
+		Currency: strings.ToUpper(get("currency")),
+		Language: get("language"),
+		ISBN:     normalizeISBN(get("isbn")),
+	}
+	row.ISBN = row.book.ISBN
+	if raw := get("price"); raw != "" {
+		price, currency, err := parsePriceIn(raw, row.book.Currency)
+		if err != nil {
+			row.Status = rowInvalid
+			row.Errors = append(row.Errors, fieldError{Field: apiName("price"), Message: err.Error()})
+		}
+		row.book.Price = price
+		if row.book.Currency == "" && currency != "" {
+			row.book.Currency = currency
+			row.columns["currency"] = true
+		}
+	}
+	if raw := get("stock"); raw != "" {
+		stock, err := strconv.Atoi(raw)
+		if err != nil {
+			row.Status = rowInvalid
+			row.Errors = append(row.Errors, fieldError{Field: apiName("stock"), Message: "must be a whole number"})
+		}
+		row.book.Stock = stock
+	}
+	for _, e := range validateBook(row.book) {
+		if e.Field == apiName("price") && row.Status == rowInvalid {
+			continue // already reported as unparsable
+		}
+		row.Status = rowInvalid
+		row.Errors = append(row.Errors, e)
+	}
+	return row
+}
+
+// normalizeISBN strips the hyphens and spaces suppliers format ISBNs with.
+func normalizeISBN(s string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadImportCSVReportsEveryFieldError(t *testing.T) {
+	withConfig(t)
+	csv := "book_name,price,currency,isbn\n" +
+		"Dune,12.50,USD,9780441172719\n" +
+		",abc,US,123\n"
+	rows, err := readImportCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0].Status != "" || rows[0].book.Price != 12.5 {
+		t.Errorf("row 2 = %+v, want a valid row priced 12.5", rows[0])
+	}
+	bad := rows[1]
+	if bad.Status != rowInvalid || bad.Row != 3 {
+		t.Fatalf("row 3 = %+v, want invalid", bad)
+	}
+	fields := map[string]bool{}
+	for _, e := range bad.Errors {
+		fields[e.Field] = true
+	}
+	for _, want := range []string{"book_name", "price", "currency", "isbn"} {
+		if !fields[want] {
+			t.Errorf("row 3 errors %+v do not include %s", bad.Errors, want)
+		}
+	}
+}
+
+func TestReadImportCSVRejectsBadFiles(t *testing.T) {
+	for name, csv := range map[string]string{
+		"empty":          "",
+		"no book_name":   "author\nX\n",
+		"unknown column": "book_name,colour\nX,red\n",
+		"no rows":        "book_name\n",
+	} {
+		if _, err := readImportCSV(strings.NewReader(csv)); err == nil {
+			t.Errorf("%s: readImportCSV accepted %q", name, csv)
+		}
+	}
+}
+
+func TestImportDuplicatePolicies(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.AdminToken = "secret"
+	if err := db.Create(&Book{BookName: "Dune", Price: 10, ISBN: "9780441172719"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	csv := "book_name,price,isbn\n" +
+		"Dune (reissue),12.50,978-0-441-17271-9\n" +
+		"Emma,5,9780141439587\n"
+
+	tests := []struct {
+		policy        string
+		wantStatus    int
+		wantCommitted bool
+		wantDunePrice float64
+		wantBooks     int64
+	}{
+		{duplicateError, http.StatusConflict, false, 10, 1},
+		{duplicateSkip, http.StatusOK, true, 10, 2},
+		{duplicateUpdate, http.StatusOK, true, 12.5, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			db.Exec("DELETE FROM books WHERE isbn = ?", "9780141439587")
+			db.Model(&Book{}).Where("isbn = ?", "9780441172719").Updates(map[string]interface{}{"price": 10, "book_name": "Dune"})
+
+			req := httptest.NewRequest("POST", "/books/import?on_duplicate="+tt.policy, strings.NewReader(csv))
+			req.Header.Set("Content-Type", "text/csv")
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			ImportBooks(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var res importResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Committed != tt.wantCommitted {
+				t.Errorf("committed = %t, want %t", res.Committed, tt.wantCommitted)
+			}
+			var dune Book
+			db.Where("isbn = ?", "9780441172719").First(&dune)
+			if dune.Price != tt.wantDunePrice {
+				t.Errorf("Dune price = %v, want %v", dune.Price, tt.wantDunePrice)
+			}
+			var n int64
+			db.Model(&Book{}).Count(&n)
+			if n != tt.wantBooks {
+				t.Errorf("%d books stored, want %d", n, tt.wantBooks)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// bookIndexes are the secondary indexes on books that a migration creates,
+// keyed by the name -indexes refers to them by. Each backs a filter or
+// grouping that otherwise scans the whole table:
+//
+//	author  ?author= filters, /books/distinct/author, /books/tree
+//	genre   ?genre= filters, per-genre stats and the tree grouping
+//	price   /books/price-tiers and price statistics
+//	isbn    ?isbn= lookups and duplicate detection in /books/import
+//
+// The isbn index is also unique, filtered to active books that have an
+// ISBN: two books in the catalog cannot share one, while any number may
+// leave it empty and a trashed book does not block its replacement. A
+// violation is reported as a 422 on the isbn field (see constraintErrors).
+//
+// deleted_at is indexed through gorm.Model already. SQL Server cannot index
+// nvarchar(max), which is why the string columns carry size tags.
+//
+// Upgrading a database created before those tags: -migrate alters the
+// nvarchar(max) columns down to their sizes, which SQL Server refuses if a
+// row holds a longer value. checkColumnSizes looks for such rows first and
+// stops the migration naming the column; shorten or fix them, e.g.
+//
+//	UPDATE books SET author = LEFT(author, 255) WHERE DATALENGTH(author) > 510
+//
+// and run -migrate again.
+var bookIndexes = []struct {
+	name   string
+	index  string
+	column string
+	unique bool
+	where  string
+}{
+	{"author", "idx_books_author", "author", false, ""},
+	{"genre", "idx_books_genre", "genre", false, ""},
+	{"price", "idx_books_price", "price", false, ""},
+	{"isbn", "idx_books_isbn", "isbn", true, "deleted_at IS NULL AND isbn <> ''"},
+}
+
+// parseIndexList validates the -indexes flag value.
+func parseIndexList(spec string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, idx := range bookIndexes {
+			known = known || idx.name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid -indexes entry %q: must be author, genre, price or isbn", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// checkColumnSizes fails if any row of an existing books table is longer
+// than its column's size tag, before AutoMigrate tries to shrink the column.
+// nvarchar stores two bytes per character, so DATALENGTH counts trailing
+// spaces that LEN would ignore.
+func checkColumnSizes(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&Book{}) {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&Book{}); err != nil {
+		return err
+	}
+	for _, f := range stmt.Schema.Fields {
+		if f.DataType != schema.String || f.Size == 0 {
+			continue
+		}
+		var n int64
+		err := db.Table("books").Where("DATALENGTH("+f.DBName+") > ?", 2*f.Size).Count(&n).Error
+		if err != nil {
+			return fmt.Errorf("failed to check books.%s sizes: %w", f.DBName, err)
+		}
+		if n > 0 {
+			return fmt.Errorf("cannot migrate: %d rows have books.%s longer than %d characters; shorten them, then run -migrate again", n, f.DBName, f.Size)
+		}
+	}
+	return nil
+}
+
+// ensureIndexes creates the configured indexes that do not exist yet. It
+// runs after AutoMigrate, so the columns are already the indexable sizes.
+// A unique index that an older release created as a plain one is dropped
+// and created again; that fails, naming the index, while active books
+// still share a value.
+func ensureIndexes(db *gorm.DB, names []string) error {
+	enabled := map[string]bool{}
+	for _, name := range names {
+		enabled[name] = true
+	}
+	for _, idx := range bookIndexes {
+		if !enabled[idx.name] {
+			continue
+		}
+		if db.Migrator().HasIndex(&Book{}, idx.index) {
+			if !idx.unique {
+				continue
+			}
+			var unique bool
+			err := db.Raw("SELECT is_unique FROM sys.indexes WHERE object_id = OBJECT_ID('books') AND name = ?", idx.index).Row().Scan(&unique)
+			if err != nil {
+				return fmt.Errorf("failed to inspect index %s: %w", idx.index, err)
+			}
+			if unique {
+				continue
+			}
+			if err := db.Migrator().DropIndex(&Book{}, idx.index); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", idx.index, err)
+			}
+		}
+		if err := db.Exec(indexDDL(idx.index, idx.column, idx.unique, idx.where)).Error; err != nil {
+			return fmt.Errorf("failed to create index %s: %w", idx.index, err)
+		}
+		log.Printf("INFO created index %s on books(%s)", idx.index, idx.column)
+	}
+	return nil
+}
+
+// indexDDL is the CREATE INDEX statement for a books index.
+func indexDDL(index, column string, unique bool, where string) string {
+	ddl := "CREATE INDEX "
+	if unique {
+		ddl = "CREATE UNIQUE INDEX "
+	}
+	ddl += index + " ON books (" + column + ")"
+	if where != "" {
+		ddl += " WHERE " + where
+	}
+	return ddl
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIndexList(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"author", []string{"author"}, false},
+		{"author, genre,price,isbn", []string{"author", "genre", "price", "isbn"}, false},
+		{"author,,isbn,", []string{"author", "isbn"}, false},
+		{"title", nil, true},
+		{"author,Genre", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseIndexList(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIndexList(%q) error = %v, wantErr %t", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIndexList(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestIndexDDL(t *testing.T) {
+	for _, idx := range bookIndexes {
+		got := indexDDL(idx.index, idx.column, idx.unique, idx.where)
+		want := "CREATE INDEX " + idx.index + " ON books (" + idx.column + ")"
+		if idx.name == "isbn" {
+			want = "CREATE UNIQUE INDEX idx_books_isbn ON books (isbn) WHERE deleted_at IS NULL AND isbn <> ''"
+		}
+		if got != want {
+			t.Errorf("%s: %s, want %s", idx.name, got, want)
+		}
+	}
+}
+
+func TestEnsureIndexesCreatesConfiguredIndexes(t *testing.T) {
+	db := testDB(t)
+	for _, idx := range bookIndexes {
+		if db.Migrator().HasIndex(&Book{}, idx.index) {
+			if err := db.Migrator().DropIndex(&Book{}, idx.index); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := ensureIndexes(db, []string{"author", "genre", "isbn"}); err != nil {
+		t.Fatal(err)
+	}
+	// A second run finds them in place.
+	if err := ensureIndexes(db, []string{"author", "genre", "isbn"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, idx := range bookIndexes {
+		want := idx.name != "price"
+		if got := db.Migrator().HasIndex(&Book{}, idx.index); got != want {
+			t.Errorf("HasIndex(%s) = %t, want %t", idx.index, got, want)
+		}
+	}
+}
+
+func TestCheckColumnSizesRejectsOversizedRows(t *testing.T) {
+	db := testDB(t)
+	t.Cleanup(func() {
+		db.Migrator().DropTable("list_entries", "reviews", "books")
+		db.AutoMigrate(migratedModels...)
+	})
+	// The books table as it was before the size tags.
+	if err := db.Migrator().DropTable("list_entries", "reviews", "books"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE books (id bigint IDENTITY PRIMARY KEY, created_at datetimeoffset, updated_at datetimeoffset, deleted_at datetimeoffset, " +
+		"book_name nvarchar(max), author nvarchar(max), price float, genre nvarchar(max), currency nvarchar(max), language nvarchar(max), isbn nvarchar(max))").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumnSizes(db); err != nil {
+		t.Fatalf("empty table: %v", err)
+	}
+	if err := db.Exec("INSERT INTO books (book_name, genre) VALUES (?, ?)", "Fine", strings.Repeat("g", 100)+" ").Error; err != nil {
+		t.Fatal(err)
+	}
+	err := checkColumnSizes(db)
+	if err == nil || !strings.Contains(err.Error(), "books.genre") {
+		t.Fatalf("checkColumnSizes = %v, want an error naming books.genre", err)
+	}
+}
+
+func TestISBNIndexIsUniqueAmongActiveBooks(t *testing.T) {
+	db := testDB(t)
+	// An index left by a release that created it as a plain one.
+	if db.Migrator().HasIndex(&Book{}, "idx_books_isbn") {
+		if err := db.Migrator().DropIndex(&Book{}, "idx_books_isbn"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Exec("CREATE INDEX idx_books_isbn ON books (isbn)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureIndexes(db, []string{"isbn"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"No ISBN", "No ISBN either"} {
+		if err := db.Create(&Book{BookName: name}).Error; err != nil {
+			t.Fatalf("second book without an ISBN: %v", err)
+		}
+	}
+	first := Book{BookName: "Hobbit", ISBN: "9780261102361"}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	err := db.Create(&Book{BookName: "Copy", ISBN: first.ISBN}).Error
+	if errs := constraintErrors(err); len(errs) != 1 || errs[0].Field != "isbn" {
+		t.Fatalf("duplicate ISBN: %v, want a field error on isbn", err)
+	}
+	if err := db.Delete(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Book{BookName: "Reissue", ISBN: first.ISBN}).Error; err != nil {
+		t.Errorf("ISBN of a trashed book: %v, want it free", err)
+	}
+}
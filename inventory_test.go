@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInventoryValue(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	books := []Book{
+		{BookName: "A", Genre: "Fantasy", Currency: "USD", Price: 10, Stock: 3},
+		{BookName: "B", Genre: "Fantasy", Currency: "EUR", Price: 5, Stock: 2},
+		{BookName: "C", Genre: "fantasy", Currency: "USD", Price: 1, Stock: 1},
+		{BookName: "D", Genre: "Poetry", Currency: "USD", Price: 7}, // no stock
+		{BookName: "E", Genre: "Poetry", Stock: 4},                  // no price
+	}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Rows written before the stock column existed hold NULL.
+	if err := db.Exec("UPDATE books SET stock = NULL, price = NULL WHERE book_name = 'E'").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	GetInventoryValue(rec, httptest.NewRequest("GET", "/books/inventory-value", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var got inventoryValue
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Units != 6 || got.Total["USD"] != 31 || got.Total["EUR"] != 10 {
+		t.Errorf("totals = %d units, %v; want 6 units, USD 31 and EUR 10", got.Units, got.Total)
+	}
+	if len(got.Genres) != 3 || got.Genres[0].Genre != "Fantasy" || got.Genres[0].Value["USD"] != 30 ||
+		got.Genres[1].Genre != "Poetry" || got.Genres[1].Units != 0 || got.Genres[2].Genre != "fantasy" {
+		t.Errorf("genres = %+v", got.Genres)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Lifecycle states. An instance starts out starting, becomes ready once
+// the database is connected, migrated and warmed, and drains on shutdown.
+const (
+	stateStarting = "starting"
+	stateReady    = "ready"
+	stateDraining = "draining"
+)
+
+// startupRetryAfter is the Retry-After sent while the instance is starting.
+const startupRetryAfter = 5
+
+// lifecycle tracks the instance's state and fronts the router with it. The
+// router only exists once startup is done, since it is built from what
+// startup sets up (the breaker, the database slots).
+type lifecycle struct {
+	mu      sync.Mutex
+	state   string
+	handler http.Handler
+}
+
+var appState = &lifecycle{state: stateStarting}
+
+// ready moves a starting instance to ready, serving handler from then on.
+// It reports false if shutdown began first.
+func (l *lifecycle) ready(handler http.Handler) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != stateStarting {
+		return false
+	}
+	l.state, l.handler = stateReady, handler
+	return true
+}
+
+// drain moves the instance to draining. Requests keep being served, but
+// readiness fails so load balancers stop sending new ones.
+func (l *lifecycle) drain() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = stateDraining
+}
+
+func (l *lifecycle) current() (string, http.Handler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state, l.handler
+}
+
+// ServeHTTP answers /readyz itself unless the instance is ready, reporting
+// the state with a 503. While the instance is starting every other route
+// gets a 503 with Retry-After; once it has a router, requests go there,
+// draining included.
+func (l *lifecycle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	state, handler := l.current()
+	switch {
+	case state != stateReady && r.URL.Path == "/readyz":
+		respondJSON(w, http.StatusServiceUnavailable, readiness{Status: state})
+	case handler == nil:
+		w.Header().Set("Retry-After", strconv.Itoa(startupRetryAfter))
+		http.Error(w, "Service is starting, try again shortly", http.StatusServiceUnavailable)
+	default:
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// warmUp opens a first connection to the primary, so the first request does
+// not pay for the login, and fills the registered caches. A cache that
+// fails to warm is only logged; it fills itself on demand.
+func warmUp(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	for name, c := range caches {
+		if err := c.Warm(ctx); err != nil {
+			log.Printf("WARNING: failed to warm the %s cache: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLifecycleGate(t *testing.T) {
+	l := &lifecycle{state: stateStarting}
+	served := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	if rec := get("/books"); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("starting: /books = %d (Retry-After %q), want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get("/readyz"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"starting"`) {
+		t.Errorf("starting: /readyz = %d %s", rec.Code, rec.Body)
+	}
+
+	if !l.ready(served) {
+		t.Fatal("ready() on a starting instance = false")
+	}
+	if rec := get("/books"); rec.Code != http.StatusTeapot {
+		t.Errorf("ready: /books = %d, want it served", rec.Code)
+	}
+	if rec := get("/readyz"); rec.Code != http.StatusTeapot {
+		t.Errorf("ready: /readyz = %d, want the router's own answer", rec.Code)
+	}
+
+	l.drain()
+	if rec := get("/books"); rec.Code != http.StatusTeapot {
+		t.Errorf("draining: /books = %d, want it still served", rec.Code)
+	}
+	if rec := get("/readyz"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"draining"`) {
+		t.Errorf("draining: /readyz = %d %s", rec.Code, rec.Body)
+	}
+	if l.ready(served) {
+		t.Error("ready() after drain = true")
+	}
+}
+
+func TestServeShutsDownWhenCancelled(t *testing.T) {
+	withConfig(t)
+	saved := appState
+	t.Cleanup(func() { appState = saved })
+	appState = &lifecycle{state: stateReady, handler: http.NotFoundHandler()}
+	cfg.Port, cfg.TLSCert, cfg.DrainDelay, cfg.ShutdownTimeout = "0", "", 0, time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, appState) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve = %v, want nil after a clean shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after its context was cancelled")
+	}
+	if state, _ := appState.current(); state != stateDraining {
+		t.Errorf("state after shutdown = %s, want draining", state)
+	}
+}
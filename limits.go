@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Default request body limits. Regular writes carry a single book, so they
+// stay tight; bulk endpoints (batch, imports) get a larger allowance.
+const (
+	defaultRegularMaxBody = 1 << 20  // 1 MiB
+	defaultUploadMaxBody  = 32 << 20 // 32 MiB
+)
+
+// limitBody caps the request body at n bytes before it reaches next. A
+// declared Content-Length over the cap is refused with 413 before anything is
+// read.
+//
+// That matters for clients sending `Expect: 100-continue`: net/http only
+// answers "100 Continue" once a handler first reads the body, so every check
+// that can reject a request (this one, auth, Content-Type, query parameters)
+// must run before the body is touched. Rejecting then sends the final status
+// straight away and the client never uploads the body.
+func limitBody(n int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next(w, r)
+	}
+}
+
+// decodeJSON decodes the request body into v, answering 413 when the body
+// exceeds its limit and 400 for anything else. It reports whether decoding
+// succeeded. With -json-naming=camel, camelCase keys are accepted too.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	var err error
+	if cfg.JSONNaming == namingCamel {
+		err = decodeCamelJSON(r, v)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(v)
+	}
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+	return false
+}
+
+func decodeCamelJSON(r *http.Request, v interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	data, err := renameJSON(body, camelToSnake)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
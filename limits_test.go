@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingReader records how much of a request body the client sent.
+type countingReader struct {
+	r    io.Reader
+	sent *int
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.sent += n
+	return n, err
+}
+
+func TestExpectContinueRejectsBeforeUpload(t *testing.T) {
+	defer func(saved Config) { cfg = saved }(cfg)
+	cfg.AdminToken = "secret"
+	cfg.UploadMaxBody = 1 << 10
+
+	handler := limitBody(cfg.UploadMaxBody, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		if r.Header.Get("Content-Type") != "text/csv" {
+			http.Error(w, "Content-Type must be text/csv", http.StatusUnsupportedMediaType)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		token       string
+		size        int
+		want        int
+		wantSent    bool
+	}{
+		{"too large", "text/csv", "secret", 4096, http.StatusRequestEntityTooLarge, false},
+		{"wrong content type", "text/plain", "secret", 100, http.StatusUnsupportedMediaType, false},
+		{"not admin", "text/csv", "wrong", 100, http.StatusUnauthorized, false},
+		{"accepted", "text/csv", "secret", 100, http.StatusNoContent, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := 0
+			body := countingReader{bytes.NewReader(bytes.Repeat([]byte("a"), tt.size)), &sent}
+			req, err := http.NewRequest("POST", srv.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = int64(tt.size)
+			req.Header.Set("Expect", "100-continue")
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if (sent > 0) != tt.wantSent {
+				t.Errorf("client sent %d body bytes, want body sent = %t", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestLimitBodyCapsUndeclaredLength(t *testing.T) {
+	handler := limitBody(10, func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]string
+		if decodeJSON(w, r, &v) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"book_name": "far too long for the cap"}`))
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// ListEntry places a book at a position in a named, hand-curated list such
+// as "staff-picks". Positions run 1..n within a list with no gaps or
+// duplicates: the unique indexes rule out duplicates, and every change to a
+// list, purges included, rewrites the positions it moves in one statement.
+//
+// A list's members are the entries whose book is visible, i.e. not
+// soft-deleted; reads, adds, reorders and removals all go by that rule. The
+// entry of a trashed book keeps its place, hidden, and the book reappears
+// there if it is restored.
+type ListEntry struct {
+	ID        uint      `json:"-" gorm:"primarykey"`
+	ListName  string    `json:"-" gorm:"size:100;uniqueIndex:idx_list_entries_position,priority:1;uniqueIndex:idx_list_entries_book,priority:1"`
+	Position  int       `json:"position" gorm:"uniqueIndex:idx_list_entries_position,priority:2"`
+	BookID    uint      `json:"book_id" gorm:"uniqueIndex:idx_list_entries_book,priority:2"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// maxListSize keeps a reorder's CASE statement well under SQL Server's 2100
+// parameter limit.
+const maxListSize = 500
+
+type listItem struct {
+	Position int  `json:"position"`
+	Book     Book `json:"book"`
+}
+
+var errListChanged = errors.New("list changed")
+
+// GetList serves GET /lists/{name}: the list's members in order, numbered
+// 1..n. Trashed books are left out and do not leave gaps.
+func GetList(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	items, err := loadList(dbFor(r), mux.Vars(r)["name"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, items)
+}
+
+func loadList(db *gorm.DB, name string) ([]listItem, error) {
+	var entries []ListEntry
+	if err := db.Where("list_name = ?", name).Order("position").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.BookID
+	}
+	var books []Book
+	if len(ids) > 0 {
+		if err := db.Where("id IN ?", ids).Find(&books).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+	items := []listItem{}
+	for _, e := range entries {
+		if b, ok := byID[e.BookID]; ok {
+			items = append(items, listItem{Position: len(items) + 1, Book: b})
+		}
+	}
+	return items, nil
+}
+
+// visibleEntries splits a list's entries, in order, into its members and
+// the entries of trashed books.
+func visibleEntries(tx *gorm.DB, entries []ListEntry) (members, hidden []ListEntry, err error) {
+	if len(entries) == 0 {
+		return nil, nil, nil
+	}
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.BookID
+	}
+	var active []uint
+	if err := tx.Model(&Book{}).Where("id IN ?", ids).Pluck("id", &active).Error; err != nil {
+		return nil, nil, err
+	}
+	visible := make(map[uint]bool, len(active))
+	for _, id := range active {
+		visible[id] = true
+	}
+	for _, e := range entries {
+		if visible[e.BookID] {
+			members = append(members, e)
+		} else {
+			hidden = append(hidden, e)
+		}
+	}
+	return members, hidden, nil
+}
+
+// AddToList serves POST /lists/{name}/books with {"book_id": 7}, appending
+// the book at the end of the list. Admin-only.
+func AddToList(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	var body struct {
+		BookID uint `json:"book_id"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	status, msg := http.StatusOK, ""
+	err := dbFor(r).Transaction(func(tx *gorm.DB) error {
+		entries, err := lockList(tx, name)
+		if err != nil {
+			return err
+		}
+		// Hidden entries count against the cap: reorders renumber them too.
+		if len(entries) >= maxListSize {
+			status, msg = http.StatusConflict, fmt.Sprintf("a list holds at most %d books", maxListSize)
+			return errListChanged
+		}
+		for _, e := range entries {
+			if e.BookID == body.BookID {
+				status, msg = http.StatusConflict, "the book is already in the list"
+				return errListChanged
+			}
+		}
+		var book Book
+		if err := tx.First(&book, body.BookID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			status, msg = http.StatusUnprocessableEntity, "book not found"
+			return errListChanged
+		} else if err != nil {
+			return err
+		}
+		position := len(entries) + 1
+		return tx.Create(&ListEntry{ListName: name, BookID: body.BookID, Position: position}).Error
+	})
+	respondListChange(w, r, name, err, status, msg)
+}
+
+// RemoveFromList serves DELETE /lists/{name}/books/{id}, closing the gap the
+// book leaves. Admin-only.
+func RemoveFromList(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+	status, msg := http.StatusOK, ""
+	err = dbFor(r).Transaction(func(tx *gorm.DB) error {
+		entries, err := lockList(tx, name)
+		if err != nil {
+			return err
+		}
+		members, _, err := visibleEntries(tx, entries)
+		if err != nil {
+			return err
+		}
+		for _, entry := range members {
+			if entry.BookID == uint(id) {
+				if err := tx.Delete(&entry).Error; err != nil {
+					return err
+				}
+				return closeListGaps(tx, []ListEntry{entry})
+			}
+		}
+		status, msg = http.StatusNotFound, "the book is not in the list"
+		return errListChanged
+	})
+	respondListChange(w, r, name, err, status, msg)
+}
+
+// ReorderList serves POST /lists/{name}/reorder with {"ids": [3, 1, 2]}, the
+// list's book ids in their new order. The ids must be exactly the list's
+// members as GetList shows them, each once; otherwise nothing changes and
+// the response is a 409 (a concurrent edit) or 400. The members get
+// positions 1..n, and the hidden entries of trashed books follow them in
+// their old order, all by one UPDATE inside a transaction that holds the
+// list locked. Admin-only.
+func ReorderList(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	var body struct {
+		IDs []uint `json:"ids"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	seen := make(map[uint]bool, len(body.IDs))
+	for _, id := range body.IDs {
+		if seen[id] {
+			http.Error(w, fmt.Sprintf("book %d is listed twice", id), http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+
+	status, msg := http.StatusOK, ""
+	err := dbFor(r).Transaction(func(tx *gorm.DB) error {
+		entries, err := lockList(tx, name)
+		if err != nil {
+			return err
+		}
+		members, hidden, err := visibleEntries(tx, entries)
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			status, msg = http.StatusNotFound, "list not found"
+			return errListChanged
+		}
+		matches := len(members) == len(body.IDs)
+		for _, e := range members {
+			matches = matches && seen[e.BookID]
+		}
+		if !matches {
+			status, msg = http.StatusConflict, "ids must be exactly the books in the list; reload it and try again"
+			return errListChanged
+		}
+		var cases strings.Builder
+		args := make([]interface{}, 0, 2*len(entries)+1)
+		for i, id := range body.IDs {
+			cases.WriteString(" WHEN ? THEN ?")
+			args = append(args, id, i+1)
+		}
+		for i, e := range hidden {
+			cases.WriteString(" WHEN ? THEN ?")
+			args = append(args, e.BookID, len(body.IDs)+i+1)
+		}
+		args = append(args, name)
+		return tx.Exec("UPDATE list_entries SET position = CASE book_id"+cases.String()+" END WHERE list_name = ?", args...).Error
+	})
+	respondListChange(w, r, name, err, status, msg)
+}
+
+// lockList returns a list's entries in order, holding update locks on its
+// rows (and the range, so no entry can be added) until the transaction ends.
+func lockList(tx *gorm.DB, name string) ([]ListEntry, error) {
+	var entries []ListEntry
+	err := tx.Raw("SELECT * FROM list_entries WITH (UPDLOCK, HOLDLOCK) WHERE list_name = ? ORDER BY position", name).
+		Scan(&entries).Error
+	return entries, err
+}
+
+// closeListGaps shifts up the entries after each removed one, so positions
+// stay 1..n. It runs one statement per removed entry, from the last position
+// back, so earlier shifts do not move the later gaps.
+func closeListGaps(tx *gorm.DB, removed []ListEntry) error {
+	removed = slices.Clone(removed)
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Position > removed[j].Position })
+	for _, e := range removed {
+		err := tx.Model(&ListEntry{}).Where("list_name = ? AND position > ?", e.ListName, e.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func respondListChange(w http.ResponseWriter, r *http.Request, name string, err error, status int, msg string) {
+	switch {
+	case errors.Is(err, errListChanged):
+		http.Error(w, msg, status)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		items, err := loadList(dbFor(r), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, status, items)
+	}
+}
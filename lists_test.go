@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListReorder(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.AdminToken = "secret"
+	books := []Book{{BookName: "A"}, {BookName: "B"}, {BookName: "C"}}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	order := func(rec *httptest.ResponseRecorder) string {
+		var items []listItem
+		if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil {
+			t.Fatalf("%v: %s", err, rec.Body)
+		}
+		var names []string
+		for i, item := range items {
+			if item.Position != i+1 {
+				t.Errorf("item %d has position %d", i, item.Position)
+			}
+			names = append(names, item.Book.BookName)
+		}
+		return strings.Join(names, ",")
+	}
+
+	for _, b := range books {
+		if rec := do("POST", "/lists/staff-picks/books", fmt.Sprintf(`{"book_id":%d}`, b.ID)); rec.Code != http.StatusOK {
+			t.Fatalf("add %d: %d %s", b.ID, rec.Code, rec.Body)
+		}
+	}
+	if rec := do("POST", "/lists/staff-picks/books", fmt.Sprintf(`{"book_id":%d}`, books[0].ID)); rec.Code != http.StatusConflict {
+		t.Errorf("adding a book twice: %d, want 409", rec.Code)
+	}
+
+	rec := do("POST", "/lists/staff-picks/reorder", fmt.Sprintf(`{"ids":[%d,%d,%d]}`, books[2].ID, books[0].ID, books[1].ID))
+	if rec.Code != http.StatusOK || order(rec) != "C,A,B" {
+		t.Fatalf("reorder: %d %s", rec.Code, rec.Body)
+	}
+	for _, body := range []string{
+		fmt.Sprintf(`{"ids":[%d,%d]}`, books[0].ID, books[1].ID),
+		fmt.Sprintf(`{"ids":[%d,%d,%d]}`, books[0].ID, books[1].ID, books[1].ID),
+	} {
+		if rec := do("POST", "/lists/staff-picks/reorder", body); rec.Code == http.StatusOK {
+			t.Errorf("reorder with %s succeeded", body)
+		}
+	}
+
+	rec = do("DELETE", fmt.Sprintf("/lists/staff-picks/books/%d", books[0].ID), "")
+	if rec.Code != http.StatusOK || order(rec) != "C,B" {
+		t.Errorf("remove: %d %s", rec.Code, rec.Body)
+	}
+	if got := order(do("GET", "/lists/staff-picks", "")); got != "C,B" {
+		t.Errorf("list after remove = %s, want C,B", got)
+	}
+}
+
+func TestListMembersSkipTrashedBooks(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	cfg.AdminToken = "secret"
+	books := []Book{{BookName: "A"}, {BookName: "B"}, {BookName: "C"}}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	router := newRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, b := range books {
+		if rec := do("POST", "/lists/staff-picks/books", fmt.Sprintf(`{"book_id":%d}`, b.ID)); rec.Code != http.StatusOK {
+			t.Fatalf("add %d: %d %s", b.ID, rec.Code, rec.Body)
+		}
+	}
+	if err := db.Delete(&books[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var items []listItem
+	if err := json.Unmarshal(do("GET", "/lists/staff-picks", "").Body.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Position != 1 || items[1].Position != 2 {
+		t.Fatalf("list with a trashed book = %+v, want A and C at 1 and 2", items)
+	}
+	rec := do("POST", "/lists/staff-picks/reorder", fmt.Sprintf(`{"ids":[%d,%d]}`, books[2].ID, books[0].ID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reorder over the visible books: %d %s", rec.Code, rec.Body)
+	}
+	if rec := do("DELETE", fmt.Sprintf("/lists/staff-picks/books/%d", books[1].ID), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("removing the trashed book: %d, want 404", rec.Code)
+	}
+
+	var positions []int
+	if err := db.Model(&ListEntry{}).Where("list_name = ?", "staff-picks").Order("position").Pluck("position", &positions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(positions) != "[1 2 3]" {
+		t.Errorf("stored positions = %v, want 1..3 with the hidden entry last", positions)
+	}
+}
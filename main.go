@@ -3,123 +3,375 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
-	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/secrets"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
 	"github.com/gorilla/mux"
+	"golang.org/x/sync/semaphore"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 )
 
+// Book is a catalog entry. The validate tags are described in validation.go;
+// the column sizes follow them so the filtered columns can be indexed (see
+// indexes.go).
 type Book struct {
 	gorm.Model
-	BookName string  `json:"book_name,omitempty"`
-	Author   string  `json:"author,omitempty"`
-	Price    float64 `json:"price,omitempty"`
+	BookName string  `json:"book_name,omitempty" gorm:"size:255" validate:"required,maxlen=255"`
+	Author   string  `json:"author,omitempty" gorm:"size:255" validate:"maxlen=255"`
+	Price    float64 `json:"price,omitempty" validate:"min=0,max=1000000"`
+	Genre    string  `json:"genre,omitempty" gorm:"size:100" validate:"maxlen=100"`
+	Currency string  `json:"currency,omitempty" gorm:"size:3" validate:"currency"`
+	Language string  `json:"language,omitempty" gorm:"size:35" validate:"maxlen=35"`
+	ISBN     string  `json:"isbn,omitempty" gorm:"size:13" validate:"isbn"`
+	Stock    int     `json:"stock,omitempty" validate:"min=0"`
 }
 
+// migratedModels are the tables -migrate creates and updates.
+var migratedModels = []interface{}{&Book{}, &Review{}, &ListEntry{}}
+
 var DB *gorm.DB
 var err error
 
-func initDB() {
-	// Set up context and credentials
-	ctx := context.Background()
+// keyVaultSecret retrieves a secret from Key Vault.
+func keyVaultSecret(ctx context.Context, name string) (string, error) {
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
-		log.Fatalf("failed to get a credential: %v", err)
+		return "", fmt.Errorf("failed to get a credential: %w", err)
 	}
 
 	// Create a Key Vault client
-	client, err := secrets.NewClient("https://sqlkeyvaultdb.vault.azure.net/", cred, nil)
+	client, err := azsecrets.NewClient(cfg.KeyVaultURL, cred, nil)
 	if err != nil {
-		log.Fatalf("failed to create key vault client: %v", err)
+		return "", fmt.Errorf("failed to create key vault client: %w", err)
 	}
 
-	// Retrieve the secret (password)
-	secretResp, err := client.GetSecret(ctx, "sqlkeysecretdb", nil)
+	// Retrieve the latest version of the secret
+	secretResp, err := client.GetSecret(ctx, name, "", nil)
 	if err != nil {
-		log.Fatalf("failed to get secret: %v", err)
+		return "", fmt.Errorf("failed to get secret %s: %w", name, err)
+	}
+	if secretResp.Value == nil || *secretResp.Value == "" {
+		return "", fmt.Errorf("failed to get secret %s: secret has no value", name)
+	}
+	return *secretResp.Value, nil
+}
+
+// buildDSN assembles the SQL Server connection string. url.URL escapes the
+// password, which may contain characters such as '@' or '/'.
+func buildDSN(password string) string {
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(cfg.DBUser, password),
+		Host:     net.JoinHostPort(cfg.DBHost, cfg.DBPort),
+		RawQuery: url.Values{"database": {cfg.DBName}}.Encode(),
+	}
+	return withConnectionOptions(u.String())
+}
+
+// withConnectionOptions adds DB_APP_NAME as the "app name" and
+// DB_APPLICATION_INTENT as ApplicationIntent to a sqlserver:// connection
+// string, unless it already sets them. Other forms are returned unchanged.
+func withConnectionOptions(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme != "sqlserver" {
+		return dsn
+	}
+	q := u.Query()
+	if q.Get("app name") == "" && cfg.DBAppName != "" {
+		q.Set("app name", cfg.DBAppName)
+	}
+	if q.Get("ApplicationIntent") == "" && cfg.DBApplicationIntent != "" {
+		q.Set("ApplicationIntent", cfg.DBApplicationIntent)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// connectionDSN returns the connection string to use. When
+// KEY_VAULT_DSN_SECRET names a Key Vault secret holding a complete
+// connection string, that is used, with only the app name and intent added
+// where it lacks them; otherwise the DSN is built from the DB_* settings and
+// the password secret.
+func connectionDSN(ctx context.Context) (string, error) {
+	if cfg.KeyVaultDSNSecret != "" {
+		dsn, err := keyVaultSecret(ctx, cfg.KeyVaultDSNSecret)
+		if err == nil {
+			log.Printf("INFO using the connection string from Key Vault secret %s", cfg.KeyVaultDSNSecret)
+			return withConnectionOptions(dsn), nil
+		}
+		log.Printf("WARNING: %v; building the connection string from DB_* settings instead", err)
 	}
 
-	password := *secretResp.Value
+	password, err := keyVaultSecret(ctx, cfg.KeyVaultSecret)
+	if err != nil {
+		// Key Vault stays the source of truth; DB_PASSWORD is only used when
+		// the operator opted in with -allow-env-password.
+		envPassword := os.Getenv("DB_PASSWORD")
+		if !cfg.AllowEnvPassword || envPassword == "" {
+			return "", err
+		}
+		log.Printf("WARNING: %v; falling back to DB_PASSWORD from the environment. Do not run like this in production.", err)
+		password = envPassword
+	}
+	return buildDSN(password), nil
+}
 
-	// Construct the DSN
-	dsn := fmt.Sprintf("sqlserver://azureuser:%s@project-sql-server1.database.windows.net:1433?database=projectdb", password)
+func initDB() {
+	// Construct the DSN, preferring Key Vault
+	dsn, err := connectionDSN(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Connect to the database
 	DB, err = gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
+	initReadReplica(dsn)
+
+	if cfg.CountCacheTTL > 0 {
+		bookCounts = newCountCache(cfg.CountCacheTTL)
+		if err := bookCounts.invalidateOnWrite(DB); err != nil {
+			log.Fatalf("failed to register count cache callbacks: %v", err)
+		}
+		registerCache("count", bookCounts)
+	}
+
+	if cfg.StatsTotals > 0 {
+		totals = &bookTotals{}
+		if err := totals.invalidateOnWrite(DB); err != nil {
+			log.Fatalf("failed to register book totals callbacks: %v", err)
+		}
+		registerCache("totals", totals)
+	}
+
+	if cfg.Debug {
+		if err := countQueries(DB); err != nil {
+			log.Fatalf("failed to register query count callbacks: %v", err)
+		}
+	}
+
+	if cfg.BreakerThreshold > 0 {
+		dbBreaker = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+		if err := dbBreaker.observe(DB); err != nil {
+			log.Fatalf("failed to register circuit breaker callbacks: %v", err)
+		}
+	}
 }
 
+// GetBooks lists books. By default the body is a bare JSON array of books.
+// With ?envelope=true, or an Accept header such as
+// `application/json; profile="envelope"`, the array is wrapped as
+//
+//	{"data": [...], "meta": {"total": 42, "count": 10, "page": 2, "page_size": 10}}
+//
+// where total counts every matching book across all pages. The "summary"
+// profile lists each book as just its id, book_name, author and price.
+// Clients that prefer `Accept: application/msgpack` get the same documents
+// encoded as MessagePack.
+//
+// Responses carry ETag and Last-Modified for the matched set, so pollers can
+// send If-None-Match or If-Modified-Since and get a cheap 304 when nothing
+// they would see has changed.
+//
+// `Range: items=0-24` selects a window instead of ?page=, answered with
+// 206 Partial Content and `Content-Range: items 0-24/total`.
 func GetBooks(w http.ResponseWriter, r *http.Request) {
 	if DB == nil {
 		http.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
+	bq, err := ParseBookQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Listing trashed books is admin-only because it exposes deleted data.
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+	if r.URL.Query().Get("explain") == "true" {
+		explainBooks(w, r, bq)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "items")
+
+	var version collectionVersion
+	err = readWithFallback(r, func(db *gorm.DB) (err error) {
+		version, err = loadCollectionVersion(db, bq)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if writeCollectionValidators(w, r, version) {
+		return
+	}
+
 	var books []Book
-	result := DB.Find(&books)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		books = nil
+		return bq.Paginate(bq.Apply(db)).Find(&books).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(books)
+
+	var data interface{} = books
+	switch {
+	case hasProfile(r, profileSummary):
+		data = summarizeBooks(books)
+	case bq.IncludeDeleted:
+		data = withDeletedAt(books)
+	}
+	if bq.Range == nil && !wantsEnvelope(r) {
+		respondBooks(w, r, http.StatusOK, data)
+		return
+	}
+	total, err := countBooks(r, bq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if bq.Range != nil {
+		writeRangeResponse(w, r, *bq.Range, total, len(books), data)
+		return
+	}
+	respondBooks(w, r, http.StatusOK, listEnvelope{Data: data, Meta: bq.Page.meta(total, len(books))})
+}
+
+// deletedBook is a Book as listed with ?include_deleted=true, with a
+// deleted_at key that is null for active books. gorm.Model's own DeletedAt
+// would be encoded too, as "DeletedAt"; a shallower field with that JSON name
+// hides it, and being always nil it is omitted.
+type deletedBook struct {
+	Book
+	DeletedAt     *time.Time `json:"deleted_at"`
+	HideDeletedAt *struct{}  `json:"DeletedAt,omitempty"`
 }
 
+func withDeletedAt(books []Book) []deletedBook {
+	out := make([]deletedBook, len(books))
+	for i, b := range books {
+		out[i].Book = b
+		if b.DeletedAt.Valid {
+			t := b.DeletedAt.Time
+			out[i].DeletedAt = &t
+		}
+	}
+	return out
+}
+
+// GetBook serves GET /book/{id}: the full book, or with the "summary" Accept
+// profile just its id, book_name, author and price. ?expand=reviews nests
+// the book's reviews in as well; /meta lists the relations -expand allows.
 func GetBook(w http.ResponseWriter, r *http.Request) {
 	if DB == nil {
 		http.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
 		http.Error(w, "Invalid ID format", http.StatusBadRequest)
 		return
 	}
+	expand, err := parseExpand(r.URL.Query().Get("expand"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(expand) > 0 {
+		getExpandedBook(w, r, id, expand)
+		return
+	}
 	var book Book
-	result := DB.First(&book, id)
-	if result.Error != nil {
+	err = readWithFallback(r, func(db *gorm.DB) error {
+		return db.First(&book, id).Error
+	})
+	if err != nil {
 		http.Error(w, "Book not found", http.StatusNotFound)
 		return
 	}
-	json.NewEncoder(w).Encode(book)
+	w.Header().Add("Vary", "Accept")
+	if hasProfile(r, profileSummary) {
+		// A different representation needs a different strong ETag.
+		w.Header().Set("ETag", representationETag(r, strings.TrimSuffix(bookETag(book), `"`)+`-summary"`))
+		respondBooks(w, r, http.StatusOK, summarizeBook(book))
+		return
+	}
+	w.Header().Set("ETag", representationETag(r, bookETag(book)))
+	respondBooks(w, r, http.StatusOK, book)
 }
 
+// CreateBook serves POST /books. Fields the body leaves out take their
+// -create-defaults value before the book is validated and stored, so the
+// response shows them. A field that is in the body always wins, even when
+// it is empty, zero or null: {"genre": ""} and {"genre": null} store no
+// genre whatever the default.
 func CreateBook(w http.ResponseWriter, r *http.Request) {
 	if DB == nil {
 		http.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	var book Book
-	err := json.NewDecoder(r.Body).Decode(&book)
+	var body json.RawMessage
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	book, err := decodeOverDefaults(body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	result := DB.Create(&book)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	book.ISBN = normalizeISBN(book.ISBN)
+	if errs := validateBook(book); len(errs) > 0 {
+		respondValidation(w, errs)
+		return
+	}
+	err = countedWriteTx(r, func(tx *gorm.DB) (totalsDelta, error) {
+		if err := tx.Create(&book).Error; err != nil {
+			return totalsDelta{}, err
+		}
+		return bookDelta(1, &book.Price), nil
+	})
+	if err != nil {
+		if clientGone(r, err) {
+			return
+		}
+		if errs := constraintErrors(err); errs != nil {
+			respondValidation(w, errs)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(book)
+	respondJSON(w, http.StatusOK, book)
 }
 
+// UpdateBook replaces a book's fields with those in the body. With
+// `Prefer: return=changed` or ?return=changed the response holds only the
+// id, the new ETag and the fields whose values changed.
 func UpdateBook(w http.ResponseWriter, r *http.Request) {
 	if DB == nil {
 		http.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -127,25 +379,54 @@ func UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var book Book
-	result := DB.First(&book, id)
+	result := dbFor(r).First(&book, id)
 	if result.Error != nil {
 		http.Error(w, "Book not found", http.StatusNotFound)
 		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&book)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	before := book
+	if !decodeJSON(w, r, &book) {
 		return
 	}
 
 	book.ID = uint(id)
-	result = DB.Save(&book)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	book.ISBN = normalizeISBN(book.ISBN)
+	if errs := validateBook(book); len(errs) > 0 {
+		respondValidation(w, errs)
 		return
 	}
-	json.NewEncoder(w).Encode(book)
+	err = countedWriteTx(r, func(tx *gorm.DB) (totalsDelta, error) {
+		old, err := lockedPrice(tx, book.ID)
+		if err != nil {
+			return totalsDelta{}, err
+		}
+		if err := tx.Save(&book).Error; err != nil {
+			return totalsDelta{}, err
+		}
+		return bookDelta(-1, old).add(bookDelta(1, &book.Price)), nil
+	})
+	if err != nil {
+		if clientGone(r, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Book not found", http.StatusNotFound)
+			return
+		}
+		if errs := constraintErrors(err); errs != nil {
+			respondValidation(w, errs)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", bookETag(book))
+	if wantsChangedOnly(r) {
+		respondChanged(w, before, book)
+		return
+	}
+	respondJSON(w, http.StatusOK, book)
 }
 
 func DeleteBook(w http.ResponseWriter, r *http.Request) {
@@ -153,7 +434,6 @@ func DeleteBook(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Database not initialized", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	id, err := strconv.Atoi(params["id"])
 	if err != nil {
@@ -162,38 +442,216 @@ func DeleteBook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var book Book
-	result := DB.First(&book, id)
+	result := dbFor(r).First(&book, id)
 	if result.Error != nil {
 		http.Error(w, "Book not found", http.StatusNotFound)
 		return
 	}
 
-	result = DB.Delete(&book, id)
-	if result.Error != nil {
-		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+	err = countedWriteTx(r, func(tx *gorm.DB) (totalsDelta, error) {
+		old, err := lockedPrice(tx, book.ID)
+		if err != nil {
+			return totalsDelta{}, err
+		}
+		if err := tx.Delete(&book, id).Error; err != nil {
+			return totalsDelta{}, err
+		}
+		return bookDelta(-1, old), nil
+	})
+	if err != nil {
+		if clientGone(r, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Book not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode("The book is deleted successfully!")
+	respondJSON(w, http.StatusOK, "The book is deleted successfully!")
+}
+
+// stripTrailingSlash serves "/books/" as "/books" so clients that append a
+// trailing slash reach the same handler without a redirect round-trip.
+func stripTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) > 1 && strings.HasSuffix(r.URL.Path, "/") {
+			r.URL.Path = strings.TrimRight(r.URL.Path, "/")
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// contentLanguage advertises the catalog's default language on every response.
+func contentLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Language", cfg.ContentLanguage)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRouter() http.Handler {
+	router := mux.NewRouter()
+	// First, so the headers are on every response from a deprecated route,
+	// including 503s from the breaker and the concurrency limit.
+	if len(cfg.Deprecations) > 0 {
+		router.Use(markDeprecated)
+	}
+	if cfg.AcceptCharset == charsetStrict {
+		router.Use(requireUTF8)
+	}
+	router.Use(defaultAccept)
+	if cfg.ContentLanguage != "" {
+		router.Use(contentLanguage)
+	}
+	if cfg.Debug {
+		router.Use(logQueryCount)
+	}
+	if cfg.LogPayloads {
+		router.Use(logPayloads)
+		log.Print("WARNING: -log-payloads is on; request bodies are written to the log")
+	}
+	// StrictSlash answers "/books/" with a 301 to "/books". Clients usually
+	// replay a redirected POST/PUT as a GET, so "strip" is safer for writes.
+	// It is set before the subrouter below, which inherits it.
+	router.StrictSlash(cfg.TrailingSlash == slashRedirect)
+
+	// Routes that never touch the database answer even while it is down or
+	// saturated.
+	router.HandleFunc("/readyz", Ready).Methods("GET")
+	router.HandleFunc("/schema/book", GetBookSchema).Methods("GET")
+	router.HandleFunc("/meta", GetMeta).Methods("GET")
+	router.HandleFunc("/admin/routes", listRoutes(router)).Methods("GET")
+	// Tests a connection on a pool of its own, so it does not need a slot.
+	router.HandleFunc("/admin/db/test", limitBody(cfg.RegularMaxBody, CheckDBConnection)).Methods("POST")
+	router.HandleFunc("/validate/price", limitBody(cfg.RegularMaxBody, ValidatePrice)).Methods("POST")
+
+	// Backups read the whole catalog, so instead of holding a
+	// -db-max-concurrent slot throughout they are capped by backupSlots.
+	streams := router.NewRoute().Subrouter()
+	if dbBreaker != nil {
+		streams.Use(guardDB)
+	}
+	streams.HandleFunc("/books/backup.zip", GetBackup).Methods("GET", "HEAD")
+
+	// Everything else queries the database, so it sits behind the
+	// concurrency limit and the circuit breaker.
+	db := router.NewRoute().Subrouter()
+	if cfg.DBMaxConcurrent > 0 {
+		dbSlots = semaphore.NewWeighted(int64(cfg.DBMaxConcurrent))
+		db.Use(limitDBConcurrency)
+	}
+	if dbBreaker != nil {
+		db.Use(guardDB)
+	}
+
+	db.HandleFunc("/books", GetBooks).Methods("GET")
+	db.HandleFunc("/books/count", CountBooks).Methods("GET")
+	db.HandleFunc("/books/distinct/{field}", GetDistinct).Methods("GET")
+	db.HandleFunc("/books/price-tiers", GetPriceTiers).Methods("GET")
+	db.HandleFunc("/books/tree", GetBookTree).Methods("GET")
+	db.HandleFunc("/books/stats", GetBookStats).Methods("GET")
+	db.HandleFunc("/books/inventory-value", GetInventoryValue).Methods("GET")
+	db.HandleFunc("/books/checksum", GetChecksum).Methods("GET")
+	db.HandleFunc("/books/feed.atom", GetFeed).Methods("GET")
+	db.HandleFunc("/book/{id:[0-9]+}", GetBook).Methods("GET")
+	db.HandleFunc("/books", limitBody(cfg.RegularMaxBody, CreateBook)).Methods("POST")
+	db.HandleFunc("/books/import", limitBody(cfg.UploadMaxBody, ImportBooks)).Methods("POST")
+	db.HandleFunc("/books/bulk-restore", limitBody(cfg.RegularMaxBody, BulkRestoreBooks)).Methods("POST")
+	db.HandleFunc("/books/review-summaries", limitBody(cfg.RegularMaxBody, GetReviewSummaries)).Methods("POST")
+	db.HandleFunc("/books/price-adjust", limitBody(cfg.RegularMaxBody, AdjustPrices)).Methods("POST")
+	db.HandleFunc("/book/{id:[0-9]+}", limitBody(cfg.RegularMaxBody, UpdateBook)).Methods("PUT")
+	db.HandleFunc("/book/{id:[0-9]+}", DeleteBook).Methods("DELETE")
+
+	db.HandleFunc("/lists/{name:[a-z0-9-]{1,100}}", GetList).Methods("GET")
+	db.HandleFunc("/lists/{name:[a-z0-9-]{1,100}}/books", limitBody(cfg.RegularMaxBody, AddToList)).Methods("POST")
+	db.HandleFunc("/lists/{name:[a-z0-9-]{1,100}}/books/{id:[0-9]+}", RemoveFromList).Methods("DELETE")
+	db.HandleFunc("/lists/{name:[a-z0-9-]{1,100}}/reorder", limitBody(cfg.RegularMaxBody, ReorderList)).Methods("POST")
+
+	db.HandleFunc("/admin/cache/flush", FlushCaches).Methods("POST")
+	db.HandleFunc("/admin/orphans", GetOrphans).Methods("GET")
+	db.HandleFunc("/admin/time", GetClock).Methods("GET")
+	db.HandleFunc("/admin/validate-catalog", ValidateCatalog).Methods("GET")
+
+	batch := &batchHandler{}
+	db.HandleFunc("/batch", limitBody(cfg.UploadMaxBody, batch.ServeHTTP)).Methods("POST")
+	warnUnknownDeprecations(router)
+
+	var handler http.Handler = router
+	if cfg.TrailingSlash == slashStrip {
+		handler = stripTrailingSlash(router)
+	}
+	batch.dispatch = handler
+	return handler
 }
 
 func main() {
-	port := "8082"
-	var initDB bool
-	flag.BoolVar(&initDB, "initDB", false, "Initialize the database")
-	flag.Parse()
+	if err := loadConfig(); err != nil {
+		log.Fatal(err)
+	}
+	logConfig()
+
+	if cfg.Migrate && !cfg.AllowMigrate {
+		log.Fatal("refusing to migrate: -migrate was given but ALLOW_MIGRATE=true is not set in the environment")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The listener comes up first, so load balancers see "starting" rather
+	// than refused connections while the database is set up.
+	go startup(ctx)
+	if err := serve(ctx, serverHandler(appState)); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.CacheSnapshot != "" {
+		if err := saveCacheSnapshot(cfg.CacheSnapshot); err != nil {
+			log.Printf("WARNING: failed to save the cache snapshot: %v", err)
+		}
+	}
+}
 
+// startup connects to and migrates the database, warms it up and then
+// switches the instance to ready.
+func startup(ctx context.Context) {
 	initDB() // Call to initialize the database connection
 
-	if initDB {
-		DB.AutoMigrate(&Book{})
+	if cfg.Migrate {
+		if err := checkColumnSizes(DB); err != nil {
+			log.Fatal(err)
+		}
+		if err := DB.AutoMigrate(migratedModels...); err != nil {
+			log.Fatalf("failed to migrate database: %v", err)
+		}
+		if err := ensureIndexes(DB, cfg.Indexes); err != nil {
+			log.Fatal(err)
+		}
+		log.Print("database migration complete")
 	}
 
-	router := mux.NewRouter()
-	router.HandleFunc("/books", GetBooks).Methods("GET")
-	router.HandleFunc("/book/{id:[0-9]+}", GetBook).Methods("GET")
-	router.HandleFunc("/books", CreateBook).Methods("POST")
-	router.HandleFunc("/book/{id:[0-9]+}", UpdateBook).Methods("PUT")
-	router.HandleFunc("/book/{id:[0-9]+}", DeleteBook).Methods("DELETE")
+	if err := warmUp(ctx); err != nil {
+		log.Fatalf("failed to warm up the database connection: %v", err)
+	}
+	if cfg.CacheSnapshot != "" {
+		n, err := restoreCacheSnapshot(ctx, cfg.CacheSnapshot)
+		if err != nil {
+			log.Printf("WARNING: failed to restore the cache snapshot: %v", err)
+		}
+		log.Printf("INFO warmed %d cached counts from %s", n, cfg.CacheSnapshot)
+	}
 
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	if cfg.TrashRetention > 0 {
+		go purgeTrashEvery(ctx, cfg.PurgeInterval)
+	}
+	if totals != nil {
+		go totals.reconcileEvery(ctx, cfg.StatsTotals)
+	}
+
+	if appState.ready(newRouter()) {
+		log.Print("INFO ready")
+	}
 }
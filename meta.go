@@ -0,0 +1,65 @@
+package main
+
+import "net/http"
+
+type metaExpand struct {
+	Allowed []string `json:"allowed"`
+	Max     int      `json:"max"`
+}
+
+type metaPaging struct {
+	DefaultPageSize int `json:"default_page_size"`
+	MaxPageSize     int `json:"max_page_size"`
+}
+
+type metaDatabase struct {
+	Dialect     string          `json:"dialect"`
+	ReadReplica bool            `json:"read_replica"`
+	Features    map[string]bool `json:"features"`
+}
+
+type meta struct {
+	Expand   metaExpand   `json:"expand"`
+	Paging   metaPaging   `json:"paging"`
+	Database metaDatabase `json:"database"`
+}
+
+// dialectFeatures lists, per GORM dialect, the database features whose
+// availability changes what this service does. Only sqlserver is built in;
+// a new driver needs an entry here.
+var dialectFeatures = map[string]map[string]bool{
+	"sqlserver": {
+		"snapshot_isolation": true,  // backup.zip files agree with each other
+		"row_locks":          true,  // list edits lock the list (UPDLOCK, HOLDLOCK)
+		"binary_collation":   true,  // /books/tree groups names byte-wise
+		"constraint_errors":  true,  // constraint violations become 422s naming the field
+		"full_text_search":   false, // text filters use LIKE
+		"advisory_locks":     false, // nothing takes application locks
+	},
+}
+
+// databaseMeta describes the connected database, or reports an empty
+// dialect while there is none.
+func databaseMeta() metaDatabase {
+	m := metaDatabase{Features: map[string]bool{}}
+	if DB == nil {
+		return m
+	}
+	m.Dialect = DB.Dialector.Name()
+	m.ReadReplica = ReadDB != nil
+	for name, ok := range dialectFeatures[m.Dialect] {
+		m.Features[name] = ok
+	}
+	return m
+}
+
+// GetMeta serves GET /meta: the limits this instance applies to queries and
+// the database features it runs with, so clients and operators can
+// discover them instead of hard-coding them.
+func GetMeta(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, meta{
+		Expand:   metaExpand{Allowed: cfg.ExpandAllowed, Max: cfg.MaxExpand},
+		Paging:   metaPaging{DefaultPageSize: cfg.DefaultPageSize, MaxPageSize: cfg.MaxPageSize},
+		Database: databaseMeta(),
+	})
+}
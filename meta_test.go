@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestGetMeta(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	for _, tt := range []struct {
+		db       *gorm.DB
+		database string
+	}{
+		{nil, `{"dialect":"","read_replica":false,"features":{}}`},
+		{dryRunDB(t), `{"dialect":"sqlserver","read_replica":false,"features":{"advisory_locks":false,"binary_collation":true,` +
+			`"constraint_errors":true,"full_text_search":false,"row_locks":true,"snapshot_isolation":true}}`},
+	} {
+		DB = tt.db
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, httptest.NewRequest("GET", "/meta", nil))
+		want := `{"expand":{"allowed":["reviews"],"max":1},"paging":{"default_page_size":0,"max_page_size":100},"database":` + tt.database + `}`
+		if got := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || got != want {
+			t.Errorf("GET /meta = %d %s, want 200 %s", rec.Code, got, want)
+		}
+	}
+}
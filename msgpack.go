@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+	"gorm.io/gorm"
+)
+
+const contentTypeMsgpack = "application/msgpack"
+
+// wantsMsgpack reports whether the Accept header prefers MessagePack
+// (application/msgpack, or the older application/x-msgpack) to JSON. Ties go
+// to JSON, so a bare */* keeps getting JSON.
+func wantsMsgpack(r *http.Request) bool {
+	var qMsgpack, qJSON float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case contentTypeMsgpack, "application/x-msgpack":
+			qMsgpack = max(qMsgpack, q)
+		case "application/json", "application/*", "*/*":
+			qJSON = max(qJSON, q)
+		}
+	}
+	return qMsgpack > qJSON
+}
+
+// respondBooks writes book data as MessagePack when the client prefers it
+// and as JSON otherwise. Callers that hand out strong ETags must tell the
+// two apart themselves (see representationETag).
+func respondBooks(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	if !wantsMsgpack(r) {
+		respondJSON(w, status, v)
+		return
+	}
+	data, err := encodeMsgpack(v)
+	if err != nil {
+		log.Printf("failed to encode response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeMsgpack)
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// representationETag gives the MessagePack encoding of a resource its own
+// strong ETag, derived from the JSON one.
+func representationETag(r *http.Request, etag string) string {
+	if !wantsMsgpack(r) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + `-msgpack"`
+}
+
+func init() {
+	// gorm.DeletedAt is a struct; like its MarshalJSON, encode it as nil or
+	// the time.
+	msgpack.Register(gorm.DeletedAt{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			d := v.Interface().(gorm.DeletedAt)
+			if !d.Valid {
+				return e.EncodeNil()
+			}
+			return e.EncodeTime(d.Time)
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			if c, err := d.PeekCode(); err != nil || c == msgpcode.Nil {
+				v.Set(reflect.ValueOf(gorm.DeletedAt{}))
+				return d.DecodeNil()
+			}
+			t, err := d.DecodeTime()
+			v.Set(reflect.ValueOf(gorm.DeletedAt{Time: t, Valid: err == nil}))
+			return err
+		})
+}
+
+// encodeMsgpack encodes v as MessagePack with the same keys as the JSON
+// encoding: the json struct tags (omitempty included) and, with
+// -json-naming=camel, camelCase names. Integers use the smallest encoding
+// that holds them; floats stay float64 whatever their value, so a field
+// keeps one wire type. Timestamps use the MessagePack timestamp extension.
+func encodeMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if cfg.JSONNaming != namingCamel {
+		return buf.Bytes(), nil
+	}
+	var out bytes.Buffer
+	if err := renameMsgpack(msgpack.NewDecoder(&buf), msgpack.NewEncoder(&out), snakeToCamel); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// renameMsgpack copies one value from dec to enc, renaming map keys.
+// Scalars are copied verbatim.
+func renameMsgpack(dec *msgpack.Decoder, enc *msgpack.Encoder, rename func(string) string) error {
+	c, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	switch {
+	case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+		n, err := dec.DecodeMapLen()
+		if err != nil {
+			return err
+		}
+		if err := enc.EncodeMapLen(n); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			key, err := dec.DecodeString()
+			if err != nil {
+				return err
+			}
+			if err := enc.EncodeString(rename(key)); err != nil {
+				return err
+			}
+			if err := renameMsgpack(dec, enc, rename); err != nil {
+				return err
+			}
+		}
+		return nil
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if err := enc.EncodeArrayLen(n); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := renameMsgpack(dec, enc, rename); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		raw, err := dec.DecodeRaw()
+		if err != nil {
+			return err
+		}
+		return enc.Encode(raw)
+	}
+}
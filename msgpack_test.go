@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gorm.io/gorm"
+)
+
+func TestEncodeMsgpack(t *testing.T) {
+	withConfig(t)
+	deleted := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	books := []Book{
+		{Model: gorm.Model{ID: 1}, BookName: "Dune", Price: 12},
+		{Model: gorm.Model{ID: 2, DeletedAt: gorm.DeletedAt{Time: deleted, Valid: true}}, BookName: "Emma", Price: 9.5},
+	}
+	data, err := encodeMsgpack(books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]interface{}
+	if err := msgpack.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("%d books, want 2", len(got))
+	}
+	// A whole price stays a float: the wire type follows the field, not
+	// the value.
+	if price, ok := got[0]["price"].(float64); !ok || price != 12 {
+		t.Errorf("price = %#v, want float64 12", got[0]["price"])
+	}
+	if name := got[0]["book_name"]; name != "Dune" {
+		t.Errorf("book_name = %#v, want the JSON key and value", name)
+	}
+	if _, ok := got[0]["author"]; ok {
+		t.Errorf("empty author was encoded: %v", got[0])
+	}
+	if got[0]["DeletedAt"] != nil {
+		t.Errorf("DeletedAt = %#v, want nil for an active book", got[0]["DeletedAt"])
+	}
+	if at, ok := got[1]["DeletedAt"].(time.Time); !ok || !at.Equal(deleted) {
+		t.Errorf("DeletedAt = %#v, want %s", got[1]["DeletedAt"], deleted)
+	}
+}
+
+func TestEncodeMsgpackCamel(t *testing.T) {
+	withConfig(t)
+	cfg.JSONNaming = namingCamel
+	data, err := encodeMsgpack(map[string]interface{}{"book_name": "Dune", "tags": []interface{}{map[string]interface{}{"list_name": "x"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := msgpack.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	tags, _ := got["tags"].([]interface{})
+	if got["bookName"] != "Dune" || len(tags) != 1 || tags[0].(map[string]interface{})["listName"] != "x" {
+		t.Errorf("decoded %v, want camelCase keys at every level", got)
+	}
+}
+
+func TestWantsMsgpack(t *testing.T) {
+	tests := map[string]bool{
+		"":                                      false,
+		"*/*":                                   false,
+		"application/json":                      false,
+		"application/msgpack":                   true,
+		"application/x-msgpack":                 true,
+		"application/json, application/msgpack": false,
+		"application/json;q=0.5, application/msgpack":                    true,
+		"application/msgpack;q=0, application/json":                      false,
+		"application/msgpack, */*;q=0.1":                                 true,
+		`application/json; profile="summary";q=0.9, application/msgpack`: true,
+	}
+	for accept, want := range tests {
+		r := httptest.NewRequest("GET", "/books", nil)
+		r.Header.Set("Accept", accept)
+		if got := wantsMsgpack(r); got != want {
+			t.Errorf("wantsMsgpack(%q) = %t, want %t", accept, got, want)
+		}
+	}
+}
+
+func TestRespondBooksMsgpack(t *testing.T) {
+	withConfig(t)
+	cfg.JSONNaming = namingCamel
+	r := httptest.NewRequest("GET", "/book/1", nil)
+	r.Header.Set("Accept", "application/msgpack")
+	rec := httptest.NewRecorder()
+	respondBooks(rec, r, 200, bookSummary{ID: 1, BookName: "Dune"})
+	if ct := rec.Header().Get("Content-Type"); ct != contentTypeMsgpack {
+		t.Errorf("Content-Type = %q, want %q", ct, contentTypeMsgpack)
+	}
+	// {"id":1,"bookName":"Dune"}: the keys follow -json-naming.
+	if got, want := hex.EncodeToString(rec.Body.Bytes()), "82a2696401a8626f6f6b4e616d65a444756e65"; got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+	if got := representationETag(r, `"1-5"`); got != `"1-5-msgpack"` {
+		t.Errorf("representationETag = %s, want \"1-5-msgpack\"", got)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// JSON field naming conventions accepted by -json-naming. The struct tags
+// are snake_case; camelCase is produced by rewriting keys on the way in and
+// out, so the models are not duplicated.
+const (
+	namingSnake = "snake"
+	namingCamel = "camel"
+)
+
+// renameJSON rewrites every object key in the encoded JSON data through
+// rename, in one pass over the tokens, so a response is marshalled only once.
+// Values are copied through unchanged; numbers stay exactly as encoded.
+func renameJSON(data []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	type frame struct {
+		object bool
+		n      int // tokens written so far: keys and values alike
+	}
+	var (
+		out   bytes.Buffer
+		stack []frame
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		isKey := false
+		if len(stack) > 0 && tok != json.Delim('}') && tok != json.Delim(']') {
+			top := &stack[len(stack)-1]
+			switch {
+			case top.object && top.n%2 == 0:
+				isKey = true
+				if top.n > 0 {
+					out.WriteByte(',')
+				}
+			case top.object:
+				out.WriteByte(':')
+			case top.n > 0:
+				out.WriteByte(',')
+			}
+			top.n++
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			out.WriteRune(rune(t))
+			if t == '{' || t == '[' {
+				stack = append(stack, frame{object: t == '{'})
+			} else {
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if isKey {
+				t = rename(t)
+			}
+			if err := writeJSONString(&out, t); err != nil {
+				return nil, err
+			}
+		case json.Number:
+			out.WriteString(t.String())
+		case bool:
+			out.WriteString(strconv.FormatBool(t))
+		case nil:
+			out.WriteString("null")
+		}
+	}
+	if len(stack) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return out.Bytes(), nil
+}
+
+// writeJSONString encodes s without HTML escaping, matching respondJSON.
+func writeJSONString(out *bytes.Buffer, s string) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	out.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return nil
+}
+
+// apiName converts a snake_case field name to the configured -json-naming,
+// for field names that appear in values (validation errors, the schema)
+// rather than as keys.
+func apiName(snake string) string {
+	if cfg.JSONNaming == namingCamel {
+		return snakeToCamel(snake)
+	}
+	return snake
+}
+
+// snakeToCamel turns "book_name" into "bookName". Keys without underscores,
+// such as gorm.Model's "CreatedAt", are left alone.
+func snakeToCamel(s string) string {
+	if !strings.Contains(s, "_") {
+		return s
+	}
+	parts := strings.Split(s, "_")
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, p := range parts[1:] {
+		if p == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(p[:1]))
+		b.WriteString(p[1:])
+	}
+	return b.String()
+}
+
+// camelToSnake turns "bookName" into "book_name". Only keys that start with
+// a lower-case letter are converted, so PascalCase keys like "CreatedAt"
+// still match gorm.Model's untagged fields.
+func camelToSnake(s string) string {
+	if s == "" || !unicode.IsLower(rune(s[0])) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSnakeToCamel(t *testing.T) {
+	tests := map[string]string{
+		"book_name":       "bookName",
+		"include_deleted": "includeDeleted",
+		"price":           "price",
+		"CreatedAt":       "CreatedAt",
+		"a__b":            "aB",
+	}
+	for in, want := range tests {
+		if got := snakeToCamel(in); got != want {
+			t.Errorf("snakeToCamel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCamelToSnake(t *testing.T) {
+	tests := map[string]string{
+		"bookName":  "book_name",
+		"price":     "price",
+		"CreatedAt": "CreatedAt",
+		"":          "",
+	}
+	for in, want := range tests {
+		if got := camelToSnake(in); got != want {
+			t.Errorf("camelToSnake(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenameJSON(t *testing.T) {
+	in := `{"book_name":"Tom & Jerry <1>","nested":[{"avg_rating":4.25},[],{}],"big":12345678901234567890,"ok":true,"none":null,"key_values":"book_name"}`
+	want := `{"bookName":"Tom & Jerry <1>","nested":[{"avgRating":4.25},[],{}],"big":12345678901234567890,"ok":true,"none":null,"keyValues":"book_name"}`
+	got, err := renameJSON([]byte(in), snakeToCamel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("renameJSON =\n%s\nwant\n%s", got, want)
+	}
+	if _, err := renameJSON([]byte(`{"a":`), snakeToCamel); err == nil {
+		t.Error("renameJSON accepted truncated JSON")
+	}
+}
+
+func TestValidationFieldsFollowNaming(t *testing.T) {
+	withConfig(t)
+	cfg.JSONNaming = namingCamel
+	errs := validateBook(Book{})
+	if len(errs) == 0 || errs[0].Field != "bookName" {
+		t.Fatalf("validateBook(Book{}) = %+v, want a bookName error", errs)
+	}
+	rec := httptest.NewRecorder()
+	respondValidation(rec, errs)
+	if body := rec.Body.String(); !strings.Contains(body, `"field":"bookName"`) {
+		t.Errorf("response %s does not name the camelCase field", body)
+	}
+}
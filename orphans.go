@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// maxOrphanIDs caps how many ids each orphan report lists; count is always
+// the full total.
+const maxOrphanIDs = 1000
+
+// orphanedChildren describes a table whose rows point at a book. Add new
+// book-owned tables here so /admin/orphans checks them too.
+var orphanedChildren = []struct {
+	name  string
+	model interface{}
+	where string
+}{
+	{"reviews", &Review{}, "NOT EXISTS (SELECT 1 FROM books WHERE books.id = reviews.book_id)"},
+	{"list_entries", &ListEntry{}, "NOT EXISTS (SELECT 1 FROM books WHERE books.id = list_entries.book_id)"},
+}
+
+// deleteChildRows permanently deletes model's rows matching query and
+// returns how many went. Removed list entries have their gaps closed.
+func deleteChildRows(tx *gorm.DB, model interface{}, query interface{}, args ...interface{}) (int64, error) {
+	if _, ok := model.(*ListEntry); !ok {
+		res := tx.Unscoped().Where(query, args...).Delete(model)
+		return res.RowsAffected, res.Error
+	}
+	var entries []ListEntry
+	if err := tx.Where(query, args...).Find(&entries).Error; err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	res := tx.Unscoped().Where(query, args...).Delete(&ListEntry{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, closeListGaps(tx, entries)
+}
+
+type orphanReport struct {
+	Count   int64  `json:"count"`
+	IDs     []uint `json:"ids"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// GetOrphans serves GET /admin/orphans. It reports rows in book-owned tables
+// whose book row is gone entirely (a hard delete that skipped them), keyed by
+// table. Soft-deleted books still count as existing. With ?delete=true the
+// orphans are permanently removed in the same transaction, closing the gaps
+// they leave in lists. Admin-only.
+func GetOrphans(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	purge := r.URL.Query().Get("delete") == "true"
+
+	reports := make(map[string]*orphanReport, len(orphanedChildren))
+	err := dbFor(r).Transaction(func(tx *gorm.DB) error {
+		for _, child := range orphanedChildren {
+			rep := &orphanReport{IDs: []uint{}}
+			orphans := tx.Unscoped().Model(child.model).Where(child.where)
+			if err := orphans.Session(&gorm.Session{}).Count(&rep.Count).Error; err != nil {
+				return err
+			}
+			if err := orphans.Session(&gorm.Session{}).Order("id").Limit(maxOrphanIDs).Pluck("id", &rep.IDs).Error; err != nil {
+				return err
+			}
+			if purge && rep.Count > 0 {
+				if _, err := deleteChildRows(tx, child.model, child.where); err != nil {
+					return err
+				}
+				rep.Deleted = true
+			}
+			reports[child.name] = rep
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, reports)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// page is the window requested with ?page= and ?page_size=. A zero Size
+// means no limit, which keeps the historical "return everything" behavior
+// when neither the client nor -default-page-size asks for paging.
+type page struct {
+	Number int
+	Size   int
+	Offset int
+}
+
+func parsePage(r *http.Request) (page, error) {
+	pg := page{Number: 1, Size: cfg.DefaultPageSize}
+	q := r.URL.Query()
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return pg, fmt.Errorf("invalid page %q: must be a positive integer", v)
+		}
+		pg.Number = n
+	}
+	if v := q.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return pg, fmt.Errorf("invalid page_size %q: must be a positive integer", v)
+		}
+		pg.Size = n
+	}
+	if pg.Size > cfg.MaxPageSize {
+		pg.Size = cfg.MaxPageSize
+	}
+	if pg.Size == 0 && pg.Number > 1 {
+		return pg, fmt.Errorf("page requires page_size")
+	}
+	pg.Offset = (pg.Number - 1) * pg.Size
+	return pg, nil
+}
+
+func (pg page) apply(db *gorm.DB) *gorm.DB {
+	if pg.Size == 0 {
+		return db
+	}
+	return db.Limit(pg.Size).Offset(pg.Offset)
+}
+
+type listMeta struct {
+	Total    int64 `json:"total"`
+	Count    int   `json:"count"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size,omitempty"`
+}
+
+// listEnvelope is the opt-in {data, meta} shape for list responses.
+type listEnvelope struct {
+	Data interface{} `json:"data"`
+	Meta listMeta    `json:"meta"`
+}
+
+func (pg page) meta(total int64, count int) listMeta {
+	return listMeta{Total: total, Count: count, Page: pg.Number, PageSize: pg.Size}
+}
+
+// wantsEnvelope reports whether the client opted into the list envelope,
+// either with ?envelope=true or with the "envelope" Accept profile.
+func wantsEnvelope(r *http.Request) bool {
+	return r.URL.Query().Get("envelope") == "true" || hasProfile(r, "envelope")
+}
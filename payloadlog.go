@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// payloadLogLimit is how much of each request body -log-payloads keeps.
+const payloadLogLimit = 4 << 10
+
+// sensitiveJSONValue matches the value of JSON keys that may hold secrets,
+// connection strings included, in either naming style. It is applied to the
+// raw text so that bodies cut off at payloadLogLimit are redacted too.
+var sensitiveJSONValue = regexp.MustCompile(`("(?i:[a-z_]*(?:password|secret|token|api_?key|authorization|dsn|connection_?string)[a-z_]*)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+
+func redactPayload(body []byte) string {
+	return sensitiveJSONValue.ReplaceAllString(string(body), `$1"[REDACTED]"`)
+}
+
+// teeBody keeps the first payloadLogLimit bytes the handler reads.
+type teeBody struct {
+	io.ReadCloser
+	kept  []byte
+	total int64
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := payloadLogLimit - len(b.kept); room > 0 {
+		b.kept = append(b.kept, p[:min(n, room)]...)
+	}
+	b.total += int64(n)
+	return n, err
+}
+
+// logPayloads logs the body of every write request, as far as the handler
+// read it, so client-reported create and update bugs can be replayed. The
+// body is teed rather than read up front: the handler decodes it as usual,
+// and a request rejected before its body is read (see limitBody) still
+// never uploads it. Values of password, secret, token and API key fields
+// are redacted and at most payloadLogLimit bytes are logged. Only installed
+// with -log-payloads; the logs hold customer data, so never by default.
+func logPayloads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inBatch(r) || r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := &teeBody{ReadCloser: r.Body}
+		r.Body = body
+		next.ServeHTTP(w, r)
+		switch {
+		case body.total == 0:
+			log.Printf("DEBUG payload %s %s: body not read", r.Method, r.URL.Path)
+		case body.total > int64(len(body.kept)):
+			log.Printf("DEBUG payload %s %s (%d bytes read, first %d shown): %s", r.Method, r.URL.Path, body.total, len(body.kept), redactPayload(body.kept))
+		default:
+			log.Printf("DEBUG payload %s %s (%d bytes): %s", r.Method, r.URL.Path, body.total, redactPayload(body.kept))
+		}
+	})
+}
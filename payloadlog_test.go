@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedactPayload(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`{"book_name":"Dune","password":"hunter2"}`, `{"book_name":"Dune","password":"[REDACTED]"}`},
+		{`{"apiKey": "k\"ey", "n": 1}`, `{"apiKey": "[REDACTED]", "n": 1}`},
+		{`{"access_token":12345}`, `{"access_token":"[REDACTED]"}`},
+		{`{"dsn":"sqlserver://u:pw@h"}`, `{"dsn":"[REDACTED]"}`},
+		{`{"client_secret":"abc`, `{"client_secret":"[REDACTED]"`}, // cut off mid-value
+		{`book_name,author` + "\nDune,Herbert", `book_name,author` + "\nDune,Herbert"},
+	}
+	for _, tt := range tests {
+		if got := redactPayload([]byte(tt.in)); got != tt.want {
+			t.Errorf("redactPayload(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLogPayloadsTeesBody(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var decoded map[string]string
+	handler := logPayloads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&decoded); err != nil {
+			t.Error(err)
+		}
+	}))
+	body := `{"book_name":"Dune","token":"s3cret"}`
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/books", strings.NewReader(body)))
+
+	if decoded["token"] != "s3cret" {
+		t.Errorf("handler decoded %v, want the original body", decoded)
+	}
+	if out := logged.String(); !strings.Contains(out, `"book_name":"Dune"`) || strings.Contains(out, "s3cret") {
+		t.Errorf("log = %q, want the body with the token redacted", out)
+	}
+
+	logged.Reset()
+	big := `{"book_name":"` + strings.Repeat("x", 2*payloadLogLimit) + `"}`
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/book/1", strings.NewReader(big)))
+	if out := logged.String(); len(out) > payloadLogLimit+200 || !strings.Contains(out, "first 4096 shown") {
+		t.Errorf("log of an oversized body is %d bytes: %.200s", len(out), out)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// currencySymbols are the symbols parsePrice recognizes, with their ISO 4217
+// codes. They are tried in order, longest first, so "US$" is never read as a
+// bare "$".
+var currencySymbols = []struct {
+	symbol string
+	code   string
+}{
+	{"US$", "USD"},
+	{"CA$", "CAD"},
+	{"A$", "AUD"},
+	{"$", "USD"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+	{"¥", "JPY"},
+	{"₹", "INR"},
+}
+
+// commaDecimalCurrencies are the currencies whose prices are usually written
+// with a decimal comma ("12,50 €"). Other known currencies use a decimal
+// point; see decimalSeparatorFor.
+var commaDecimalCurrencies = map[string]bool{
+	"EUR": true, "BRL": true, "DKK": true, "NOK": true, "SEK": true, "PLN": true,
+	"CZK": true, "TRY": true, "RUB": true, "IDR": true, "VND": true, "ARS": true,
+}
+
+var pointDecimalCurrencies = map[string]bool{
+	"USD": true, "GBP": true, "JPY": true, "INR": true, "AUD": true, "CAD": true,
+	"CNY": true, "CHF": true, "NZD": true, "SGD": true, "HKD": true, "MXN": true,
+}
+
+// decimalSeparatorFor returns the decimal separator prices in currency are
+// usually written with, or "" when the currency is unknown or not given.
+func decimalSeparatorFor(currency string) string {
+	switch {
+	case commaDecimalCurrencies[currency]:
+		return ","
+	case pointDecimalCurrencies[currency]:
+		return "."
+	}
+	return ""
+}
+
+// parsePrice normalizes a human-written price such as "$1,299.00",
+// "1.299,00 €", "USD 12.5" or "12" into a number rounded to cents, along
+// with the currency code if one was given. When both ',' and '.' appear, the
+// last one is the decimal separator. A lone separator followed by exactly
+// three digits ("1,299") could be either; it is read by the currency's
+// convention, and without a currency the price is rejected as ambiguous
+// rather than guessed. Spaces are ignored.
+func parsePrice(s string) (float64, string, error) {
+	return parsePriceIn(s, "")
+}
+
+// parsePriceIn is parsePrice for a price known to be in currency (for
+// example from a separate column); a different currency in s is an error.
+func parsePriceIn(s, currency string) (float64, string, error) {
+	raw := strings.TrimSpace(s)
+	if raw == "" {
+		return 0, "", errors.New("price is empty")
+	}
+	currency = strings.ToUpper(currency)
+	setCurrency := func(code string) error {
+		if currency != "" && currency != code {
+			return fmt.Errorf("conflicting currencies %s and %s", currency, code)
+		}
+		currency = code
+		return nil
+	}
+
+	for _, cs := range currencySymbols {
+		if strings.Contains(raw, cs.symbol) {
+			if err := setCurrency(cs.code); err != nil {
+				return 0, "", err
+			}
+			raw = strings.ReplaceAll(raw, cs.symbol, "")
+		}
+	}
+	// Leading or trailing ISO code, e.g. "USD 12.50" or "12,50 EUR".
+	if fields := strings.Fields(raw); len(fields) > 1 {
+		for _, i := range []int{0, len(fields) - 1} {
+			if isCurrencyCode(fields[i]) {
+				if err := setCurrency(strings.ToUpper(fields[i])); err != nil {
+					return 0, "", err
+				}
+				fields = append(fields[:i], fields[i+1:]...)
+				break
+			}
+		}
+		raw = strings.Join(fields, "")
+	}
+	raw = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, raw)
+	if raw == "" {
+		return 0, "", errors.New("price has no digits")
+	}
+
+	lastComma, lastDot := strings.LastIndex(raw, ","), strings.LastIndex(raw, ".")
+	var decimalSep, groupSep string
+	switch {
+	case lastComma >= 0 && lastDot >= 0:
+		if lastComma > lastDot {
+			decimalSep, groupSep = ",", "."
+		} else {
+			decimalSep, groupSep = ".", ","
+		}
+	case lastComma >= 0 || lastDot >= 0:
+		sep := ","
+		if lastDot >= 0 {
+			sep = "."
+		}
+		var err error
+		if decimalSep, groupSep, err = separatorRole(raw, sep, currency); err != nil {
+			return 0, "", err
+		}
+	}
+	if groupSep != "" {
+		raw = strings.ReplaceAll(raw, groupSep, "")
+	}
+	if decimalSep == "," {
+		raw = strings.Replace(raw, ",", ".", 1)
+	}
+
+	for _, r := range raw {
+		if (r < '0' || r > '9') && r != '.' {
+			return 0, "", fmt.Errorf("invalid character %q in price", r)
+		}
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid price %q", s)
+	}
+	if math.IsInf(v, 0) {
+		return 0, "", errors.New("price is out of range")
+	}
+	return math.Round(v*100) / 100, currency, nil
+}
+
+// separatorRole decides whether sep, the only separator kind in s, is a
+// decimal or a thousands separator. Repeated, it can only be grouping. Once,
+// it is grouping only in the "1,299" shape: one to three digits not all zero
+// ("0.125" is a fraction), then exactly three. That shape is resolved by the
+// currency's convention, and is an error when the currency is unknown.
+func separatorRole(s, sep, currency string) (decimalSep, groupSep string, err error) {
+	parts := strings.Split(s, sep)
+	if len(parts) > 2 {
+		for _, group := range parts[1:] {
+			if len(group) != 3 {
+				return "", "", fmt.Errorf("invalid price %q: misplaced %q grouping", s, sep)
+			}
+		}
+		return "", sep, nil
+	}
+	lead, tail := parts[0], parts[1]
+	if len(tail) != 3 || len(lead) == 0 || len(lead) > 3 || strings.Trim(lead, "0") == "" {
+		return sep, "", nil
+	}
+	switch decimalSeparatorFor(currency) {
+	case sep:
+		return sep, "", nil
+	case "":
+		return "", "", fmt.Errorf("ambiguous price %q: %q may be a decimal or a thousands separator; add a currency or write both separators", s, sep)
+	}
+	return "", sep, nil
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+type priceValidation struct {
+	Input    string   `json:"input"`
+	Value    *float64 `json:"value,omitempty"`
+	Currency string   `json:"currency,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// ValidatePrice serves POST /validate/price. It takes {"price": "$1,299.00"}
+// and returns the normalized value, or a 422 explaining why the string is
+// not a price.
+func ValidatePrice(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Price string `json:"price"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	res := priceValidation{Input: req.Price}
+	v, currency, err := parsePrice(req.Price)
+	if err != nil {
+		res.Error = err.Error()
+		respondJSON(w, http.StatusUnprocessableEntity, res)
+		return
+	}
+	res.Value, res.Currency = &v, currency
+	respondJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     float64
+		currency string
+		wantErr  bool
+	}{
+		{"12", 12, "", false},
+		{"$1,299.00", 1299, "USD", false},
+		{"1.299,00 €", 1299, "EUR", false},
+		{"USD 12.5", 12.5, "USD", false},
+		{"12,50 EUR", 12.5, "EUR", false},
+		{"US$ 5", 5, "USD", false},
+		{"A$5.10", 5.1, "AUD", false},
+		{"0.125", 0.13, "", false},
+		{"0,5", 0.5, "", false},
+		{".125", 0.13, "", false},
+		{"$1,299", 1299, "USD", false},
+		{"€1.299", 1299, "EUR", false},
+		{"€1,299", 1.3, "EUR", false},
+		{"1,234,567", 1234567, "", false},
+		{"1.234.567 €", 1234567, "EUR", false},
+		{"1234,567", 1234.57, "", false},
+		{"1,299", 0, "", true},
+		{"1.299", 0, "", true},
+		{"1,23,4", 0, "", true},
+		{"$5 EUR", 0, "", true},
+		{"", 0, "", true},
+		{"$", 0, "", true},
+		{"12a", 0, "", true},
+	}
+	for _, tt := range tests {
+		got, currency, err := parsePrice(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePrice(%q) error = %v, want error %t", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (got != tt.want || currency != tt.currency) {
+			t.Errorf("parsePrice(%q) = %v %q, want %v %q", tt.in, got, currency, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestParsePriceInUsesCurrencyHint(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         float64
+		wantErr      bool
+	}{
+		{"1.299", "EUR", 1299, false},
+		{"1.299", "usd", 1.3, false},
+		{"1,299", "GBP", 1299, false},
+		{"1,299", "XYZ", 0, true},
+		{"$5", "EUR", 0, true},
+	}
+	for _, tt := range tests {
+		got, _, err := parsePriceIn(tt.in, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePriceIn(%q, %q) error = %v, want error %t", tt.in, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parsePriceIn(%q, %q) = %v, want %v", tt.in, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestSeparatorRole(t *testing.T) {
+	tests := []struct {
+		s, sep, currency  string
+		decimal, grouping string
+		wantErr           bool
+	}{
+		{"12,5", ",", "", ",", "", false},
+		{"0,125", ",", "", ",", "", false},
+		{"000.125", ".", "", ".", "", false},
+		{"1.299", ".", "EUR", "", ".", false},
+		{"1.299", ".", "USD", ".", "", false},
+		{"1.299", ".", "", "", "", true},
+		{"1,299,000", ",", "", "", ",", false},
+		{"1,29,000", ",", "", "", "", true},
+	}
+	for _, tt := range tests {
+		decimal, grouping, err := separatorRole(tt.s, tt.sep, tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("separatorRole(%q) error = %v, want error %t", tt.s, err, tt.wantErr)
+			continue
+		}
+		if decimal != tt.decimal || grouping != tt.grouping {
+			t.Errorf("separatorRole(%q, %q, %q) = %q, %q, want %q, %q", tt.s, tt.sep, tt.currency, decimal, grouping, tt.decimal, tt.grouping)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type priceAdjustRequest struct {
+	// Percent is the relative change, e.g. 10 for +10% or -15 for -15%.
+	Percent float64 `json:"percent"`
+}
+
+// priceChange reports one book. A dry run sets ProposedPrice; a real run
+// sets NewPrice to the price as stored by the update.
+type priceChange struct {
+	ID            uint     `json:"id"`
+	BookName      string   `json:"book_name"`
+	CurrentPrice  float64  `json:"current_price"`
+	ProposedPrice *float64 `json:"proposed_price,omitempty"`
+	NewPrice      *float64 `json:"new_price,omitempty"`
+}
+
+type priceAdjustResponse struct {
+	DryRun   bool          `json:"dry_run"`
+	Percent  float64       `json:"percent"`
+	Affected int           `json:"affected"`
+	Changes  []priceChange `json:"changes"`
+}
+
+// AdjustPrices changes the price of every book matching the list filters by
+// a percentage, rounded to two decimals. With ?dry_run=true nothing is
+// written and the response lists the current and proposed price of each
+// affected book, so the change can be reviewed before it is applied. The
+// real run reports the rows the update actually changed, re-read after the
+// UPDATE in the same transaction, with their stored new_price; affected is
+// the database's row count. Admin-only.
+func AdjustPrices(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted {
+		http.Error(w, "include_deleted is not supported for price adjustments", http.StatusBadRequest)
+		return
+	}
+	var req priceAdjustRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Percent <= -100 || math.IsNaN(req.Percent) || math.IsInf(req.Percent, 0) {
+		http.Error(w, "percent must be greater than -100", http.StatusBadRequest)
+		return
+	}
+	factor := 1 + req.Percent/100
+	resp := priceAdjustResponse{DryRun: r.URL.Query().Get("dry_run") == "true", Percent: req.Percent}
+
+	err = dbFor(r).Transaction(func(tx *gorm.DB) error {
+		var books []Book
+		if err := bq.Apply(tx).Order("id").Find(&books).Error; err != nil {
+			return err
+		}
+		if resp.DryRun {
+			resp.Changes = make([]priceChange, len(books))
+			for i, b := range books {
+				proposed := math.Round(b.Price*factor*100) / 100
+				resp.Changes[i] = priceChange{ID: b.ID, BookName: b.BookName, CurrentPrice: b.Price, ProposedPrice: &proposed}
+			}
+			resp.Affected = len(books)
+			return nil
+		}
+		if len(books) == 0 {
+			resp.Changes = []priceChange{}
+			return nil
+		}
+
+		// Update by the same filters rather than by id list, which would hit
+		// SQL Server's 2100 parameter limit on large catalogs. The float
+		// arithmetic in SQL can land on a different cent than the preview,
+		// so the stored prices are read back rather than assumed.
+		result := bq.Apply(tx).
+			Session(&gorm.Session{AllowGlobalUpdate: true}).
+			Update("price", gorm.Expr("ROUND(price * ?, 2)", factor))
+		if result.Error != nil {
+			return result.Error
+		}
+		resp.Affected = int(result.RowsAffected)
+
+		current := make(map[uint]float64, len(books))
+		for _, b := range books {
+			current[b.ID] = b.Price
+		}
+		var updated []Book
+		if err := bq.Apply(tx).Order("id").Find(&updated).Error; err != nil {
+			return err
+		}
+		resp.Changes = make([]priceChange, len(updated))
+		for i, b := range updated {
+			price := b.Price
+			resp.Changes[i] = priceChange{ID: b.ID, BookName: b.BookName, CurrentPrice: current[b.ID], NewPrice: &price}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
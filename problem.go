@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error formats accepted by -error-format.
+const (
+	errorsText    = "text"    // http.Error's text/plain message, or the handler's JSON
+	errorsProblem = "problem" // application/problem+json (RFC 7807)
+)
+
+const contentTypeProblem = "application/problem+json"
+
+// wantsProblem reports whether error responses to r should be problem
+// details: when the client lists application/problem+json in Accept, or by
+// default with -error-format=problem.
+func wantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil || mediaType != contentTypeProblem {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			return false
+		}
+		return true
+	}
+	return cfg.ErrorFormat == errorsProblem
+}
+
+// problemDetails rewrites error responses (4xx and 5xx) as RFC 7807 problem
+// details for clients that want them, so handlers keep using http.Error and
+// respondValidation. A text/plain message becomes the detail; a JSON object,
+// such as the field list of a 422, is kept as extension members. type is
+// about:blank, so title is the status text, and instance is the request
+// path. It wraps the whole server, so 404s, 405s and the startup 503s are
+// covered too.
+func problemDetails(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wantsProblem(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pw := &problemWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, r)
+		if pw.body != nil {
+			pw.writeProblem(r)
+		}
+	})
+}
+
+// problemWriter holds back the body of an error response so that it can be
+// rewritten; everything else passes straight through.
+type problemWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	body        *bytes.Buffer // non-nil while an error is being captured
+}
+
+func (w *problemWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if status >= 400 && (mediaType == "text/plain" || mediaType == "application/json") {
+		w.status, w.body = status, &bytes.Buffer{}
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.body != nil {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *problemWriter) Flush() {
+	if w.body != nil {
+		return // sent in one piece by writeProblem
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *problemWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *problemWriter) writeProblem(r *http.Request) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"about:blank","title":`)
+	writeJSONValue(&buf, http.StatusText(w.status))
+	buf.WriteString(`,"status":` + strconv.Itoa(w.status))
+
+	raw := bytes.TrimSpace(w.body.Bytes())
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	members, isObject := jsonMembers(raw)
+	switch {
+	case mediaType == "application/json" && isObject:
+		for _, m := range members {
+			switch m.key {
+			case "type", "title", "status", "instance":
+				continue // the problem's own members win
+			}
+			buf.WriteByte(',')
+			writeJSONValue(&buf, m.key)
+			buf.WriteByte(':')
+			buf.Write(m.value)
+		}
+	case mediaType == "application/json":
+		var detail string
+		if json.Unmarshal(raw, &detail) == nil {
+			buf.WriteString(`,"detail":`)
+			writeJSONValue(&buf, detail)
+		} else if len(raw) > 0 {
+			buf.WriteString(`,"detail":`)
+			buf.Write(raw)
+		}
+	case len(raw) > 0:
+		buf.WriteString(`,"detail":`)
+		writeJSONValue(&buf, string(raw))
+	}
+	buf.WriteString(`,"instance":`)
+	writeJSONValue(&buf, r.URL.Path)
+	buf.WriteString("}\n")
+
+	h := w.Header()
+	h.Set("Content-Type", contentTypeProblem)
+	h.Del("Content-Length")
+	h.Del("X-Content-Type-Options")
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(buf.Bytes()); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// jsonMembers splits a JSON object into its members, in order. It reports
+// false for anything that is not a single object.
+func jsonMembers(data []byte) ([]jsonMember, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	var members []jsonMember
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		members = append(members, jsonMember{key: tok.(string), value: value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, false
+	}
+	return members, !dec.More()
+}
+
+func writeJSONValue(buf *bytes.Buffer, v interface{}) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	buf.Truncate(buf.Len() - 1) // Encode's newline
+}
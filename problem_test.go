@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWantsProblem(t *testing.T) {
+	withConfig(t)
+	cfg.ErrorFormat = errorsText
+	tests := map[string]bool{
+		"":                         false,
+		"application/json":         false,
+		"application/problem+json": true,
+		"application/json, application/problem+json;q=0.5": true,
+		"application/problem+json;q=0":                     false,
+	}
+	for accept, want := range tests {
+		r := httptest.NewRequest("GET", "/books", nil)
+		r.Header.Set("Accept", accept)
+		if got := wantsProblem(r); got != want {
+			t.Errorf("wantsProblem(%q) = %t, want %t", accept, got, want)
+		}
+	}
+	cfg.ErrorFormat = errorsProblem
+	if !wantsProblem(httptest.NewRequest("GET", "/books", nil)) {
+		t.Error("-error-format=problem: wantsProblem without Accept = false")
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	withConfig(t)
+	cfg.ErrorFormat = errorsProblem
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{"http.Error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		}, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"Invalid ID format","instance":"/book/x"}`},
+		{"validation", func(w http.ResponseWriter, r *http.Request) {
+			respondValidation(w, []fieldError{{Field: "price", Message: "must be at least 0"}})
+		}, `{"type":"about:blank","title":"Unprocessable Entity","status":422,"errors":[{"field":"price","message":"must be at least 0"}],"instance":"/book/x"}`},
+		{"JSON string", func(w http.ResponseWriter, r *http.Request) {
+			respondJSON(w, http.StatusConflict, "already exists")
+		}, `{"type":"about:blank","title":"Conflict","status":409,"detail":"already exists","instance":"/book/x"}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		problemDetails(tt.handler).ServeHTTP(rec, httptest.NewRequest("GET", "/book/x", nil))
+		if ct := rec.Header().Get("Content-Type"); ct != contentTypeProblem {
+			t.Errorf("%s: Content-Type = %q", tt.name, ct)
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+			t.Errorf("%s: body = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProblemDetailsLeavesSuccessAlone(t *testing.T) {
+	withConfig(t)
+	cfg.ErrorFormat = errorsProblem
+	rec := httptest.NewRecorder()
+	problemDetails(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, map[string]int{"id": 1})
+	})).ServeHTTP(rec, httptest.NewRequest("GET", "/book/1", nil))
+	if rec.Header().Get("Content-Type") != contentTypeJSON || strings.TrimSpace(rec.Body.String()) != `{"id":1}` {
+		t.Errorf("success rewritten: %s %s", rec.Header().Get("Content-Type"), rec.Body)
+	}
+}
+
+func TestProblemDetailsForUnmatchedRoutes(t *testing.T) {
+	withConfig(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/nope", nil)
+	req.Header.Set("Accept", contentTypeProblem)
+	serverHandler(newRouter()).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `"status":404`) {
+		t.Errorf("404 = %d %s, want problem details", rec.Code, rec.Body)
+	}
+}
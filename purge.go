@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize is how many books one purge transaction removes, so a
+// large backlog of trash does not hold locks for long.
+const purgeBatchSize = 500
+
+// purgeTrash permanently deletes the books soft-deleted before cutoff, with
+// their reviews and list entries so none are left orphaned, and returns the
+// number of rows removed per table. The lists close up behind the removed
+// entries. Books are deleted in batches of
+// purgeBatchSize, each in its own transaction.
+func purgeTrash(ctx context.Context, db *gorm.DB, cutoff time.Time) (map[string]int64, error) {
+	removed := map[string]int64{"books": 0}
+	for _, child := range orphanedChildren {
+		removed[child.name] = 0
+	}
+	for {
+		var ids []uint
+		err := db.WithContext(ctx).Unscoped().Model(&Book{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("id").Limit(purgeBatchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return removed, err
+		}
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, child := range orphanedChildren {
+				n, err := deleteChildRows(tx, child.model, "book_id IN ?", ids)
+				if err != nil {
+					return err
+				}
+				removed[child.name] += n
+			}
+			res := tx.Unscoped().Where("id IN ?", ids).Delete(&Book{})
+			removed["books"] += res.RowsAffected
+			return res.Error
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+}
+
+// purgeTrashEvery runs purgeTrash every interval until ctx is done, removing
+// books that have been in the trash for longer than -trash-retention.
+// Every instance runs it; the deletes are idempotent, so overlapping runs
+// only repeat work.
+func purgeTrashEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cutoff := time.Now().Add(-cfg.TrashRetention)
+		removed, err := purgeTrash(ctx, DB, cutoff)
+		if err != nil {
+			log.Printf("WARNING: trash purge failed after removing %d books: %v", removed["books"], err)
+			continue
+		}
+		if removed["books"] > 0 {
+			log.Printf("INFO trash purge: removed %d books deleted before %s, with %d reviews and %d list entries",
+				removed["books"], cutoff.UTC().Format(time.RFC3339), removed["reviews"], removed["list_entries"])
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	books := []Book{{BookName: "Old trash"}, {BookName: "New trash"}, {BookName: "Active"}}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&[]Review{{BookID: books[0].ID, Rating: 4}, {BookID: books[2].ID, Rating: 5}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	entries := []ListEntry{
+		{ListName: "staff-picks", Position: 1, BookID: books[2].ID},
+		{ListName: "staff-picks", Position: 2, BookID: books[0].ID},
+		{ListName: "staff-picks", Position: 3, BookID: books[1].ID},
+	}
+	if err := db.Create(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for id, deleted := range map[uint]time.Time{books[0].ID: now.Add(-48 * time.Hour), books[1].ID: now.Add(-time.Hour)} {
+		if err := db.Model(&Book{}).Where("id = ?", id).UpdateColumn("deleted_at", deleted).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := purgeTrash(context.Background(), db, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed["books"] != 1 || removed["reviews"] != 1 || removed["list_entries"] != 1 {
+		t.Errorf("removed = %v, want 1 book with its review and list entry", removed)
+	}
+	var left []Book
+	if err := db.Unscoped().Order("id").Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 2 || left[0].ID != books[1].ID || left[1].ID != books[2].ID {
+		t.Errorf("books left = %v, want the recent trash and the active book", left)
+	}
+	var positions []int
+	if err := db.Model(&ListEntry{}).Order("position").Pluck("position", &positions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(positions) != "[1 2]" {
+		t.Errorf("list positions after the purge = %v, want [1 2]", positions)
+	}
+	if again, err := purgeTrash(context.Background(), db, now.Add(-24*time.Hour)); err != nil || again["books"] != 0 {
+		t.Errorf("second purge = %v, %v; want nothing removed", again, err)
+	}
+}
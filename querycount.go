@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+type queryCountKey struct{}
+
+// countQueries registers GORM callbacks that count each statement against
+// the request it ran for. Statements only carry a request when issued
+// through dbFor or readDBFor, which attach the request context.
+func countQueries(db *gorm.DB) error {
+	hook := func(tx *gorm.DB) {
+		if n, ok := tx.Statement.Context.Value(queryCountKey{}).(*int64); ok {
+			atomic.AddInt64(n, 1)
+		}
+	}
+	cb := db.Callback()
+	if err := cb.Query().After("gorm:query").Register("querycount:query", hook); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("querycount:create", hook); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("querycount:update", hook); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("querycount:delete", hook); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("querycount:row", hook); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("querycount:raw", hook)
+}
+
+// queryCountTrailer carries the final statement count. X-DB-Queries only
+// covers the statements run before the header went out, which for a
+// streamed response (a backup or a flushed export) is not all of them.
+const queryCountTrailer = "X-DB-Queries-Total"
+
+// queryCountWriter adds X-DB-Queries just before the response header is
+// sent, by which point a buffered handler has run its statements.
+type queryCountWriter struct {
+	http.ResponseWriter
+	count       *int64
+	wroteHeader bool
+}
+
+func (w *queryCountWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("X-DB-Queries", strconv.FormatInt(atomic.LoadInt64(w.count), 10))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *queryCountWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the header, with the count so far, and any buffered body.
+func (w *queryCountWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *queryCountWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logQueryCount counts the SQL statements each request executes, to catch
+// N+1 query patterns. The count is logged and sent as X-DB-Queries, and the
+// final count also as the X-DB-Queries-Total trailer, which clients only see
+// on chunked or HTTP/2 responses. Statements run inside /batch are counted
+// against the /batch request. Only installed with -debug.
+func logQueryCount(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inBatch(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var n int64
+		r = r.WithContext(context.WithValue(r.Context(), queryCountKey{}, &n))
+		w.Header().Add("Trailer", queryCountTrailer)
+		next.ServeHTTP(&queryCountWriter{ResponseWriter: w, count: &n}, r)
+		w.Header().Set(queryCountTrailer, strconv.FormatInt(atomic.LoadInt64(&n), 10))
+		log.Printf("DEBUG %s %s executed %d SQL statements", r.Method, r.URL.Path, atomic.LoadInt64(&n))
+	})
+}
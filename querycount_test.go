@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQueryCountStreamedResponse(t *testing.T) {
+	handler := logQueryCount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := r.Context().Value(queryCountKey{}).(*int64)
+		atomic.AddInt64(n, 1)
+		io.WriteString(w, "first chunk\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush through queryCountWriter: %v", err)
+		}
+		atomic.AddInt64(n, 2)
+		io.WriteString(w, "second chunk\n")
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("X-DB-Queries"); got != "1" {
+		t.Errorf("X-DB-Queries = %q, want 1 (statements before the flush)", got)
+	}
+	if got := resp.Trailer.Get(queryCountTrailer); got != "3" {
+		t.Errorf("%s trailer = %q, want 3", queryCountTrailer, got)
+	}
+}
+
+func TestQueryCountWriterFlushSendsHeader(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &queryCountWriter{ResponseWriter: rec, count: new(int64)}
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Flushed || rec.Header().Get("X-DB-Queries") != "0" {
+		t.Errorf("flushed = %t, X-DB-Queries = %q; want the header sent on flush", rec.Flushed, rec.Header().Get("X-DB-Queries"))
+	}
+}
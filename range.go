@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// itemsRange is a window requested with `Range: items=first-last`, the
+// convention grid libraries such as react-admin use instead of query-string
+// paging. Both ends are inclusive and zero-based.
+type itemsRange struct {
+	First int
+	Last  int
+}
+
+// parseItemsRange reads an items Range header. Malformed or non-items ranges
+// are ignored, as RFC 9110 allows, and the full list is served instead.
+func parseItemsRange(header string) (itemsRange, bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "items=")
+	if !ok {
+		return itemsRange{}, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return itemsRange{}, false
+	}
+	f, err1 := strconv.Atoi(strings.TrimSpace(first))
+	l, err2 := strconv.Atoi(strings.TrimSpace(last))
+	if err1 != nil || err2 != nil || f < 0 || l < f {
+		return itemsRange{}, false
+	}
+	// Windows are capped like page_size is.
+	if l-f+1 > cfg.MaxPageSize {
+		l = f + cfg.MaxPageSize - 1
+	}
+	return itemsRange{First: f, Last: l}, true
+}
+
+func (rg itemsRange) page() page {
+	size := rg.Last - rg.First + 1
+	return page{Number: rg.First/size + 1, Size: size, Offset: rg.First}
+}
+
+// writeRangeResponse sends a window of the collection as 206 Partial Content
+// with a Content-Range header, or 416 when the window starts past the end.
+// An empty collection is answered with 200 and "items */0".
+func writeRangeResponse(w http.ResponseWriter, r *http.Request, rg itemsRange, total int64, count int, data interface{}) {
+	switch {
+	case total == 0:
+		w.Header().Set("Content-Range", "items */0")
+		respondBooks(w, r, http.StatusOK, data)
+	case int64(rg.First) >= total:
+		w.Header().Set("Content-Range", fmt.Sprintf("items */%d", total))
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+	default:
+		w.Header().Set("Content-Range", fmt.Sprintf("items %d-%d/%d", rg.First, rg.First+count-1, total))
+		respondBooks(w, r, http.StatusPartialContent, data)
+	}
+}
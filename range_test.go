@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseItemsRange(t *testing.T) {
+	withConfig(t)
+	tests := []struct {
+		header string
+		want   itemsRange
+		ok     bool
+	}{
+		{"items=0-24", itemsRange{0, 24}, true},
+		{" items= 10 - 19 ", itemsRange{10, 19}, true},
+		{"items=5-5", itemsRange{5, 5}, true},
+		{"items=0-999", itemsRange{0, 99}, true}, // capped at MaxPageSize
+		{"", itemsRange{}, false},
+		{"bytes=0-24", itemsRange{}, false},
+		{"items=24-0", itemsRange{}, false},
+		{"items=-5-10", itemsRange{}, false},
+		{"items=0-", itemsRange{}, false},
+		{"items=a-b", itemsRange{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseItemsRange(tt.header)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseItemsRange(%q) = %+v, %t; want %+v, %t", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriteRangeResponse(t *testing.T) {
+	tests := []struct {
+		rg           itemsRange
+		total        int64
+		count        int
+		status       int
+		contentRange string
+	}{
+		{itemsRange{0, 9}, 25, 10, http.StatusPartialContent, "items 0-9/25"},
+		{itemsRange{20, 29}, 25, 5, http.StatusPartialContent, "items 20-24/25"},
+		{itemsRange{30, 39}, 25, 0, http.StatusRequestedRangeNotSatisfiable, "items */25"},
+		{itemsRange{0, 9}, 0, 0, http.StatusOK, "items */0"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		writeRangeResponse(rec, httptest.NewRequest("GET", "/books", nil), tt.rg, tt.total, tt.count, []Book{})
+		if rec.Code != tt.status || rec.Header().Get("Content-Range") != tt.contentRange {
+			t.Errorf("%+v of %d: %d %q, want %d %q", tt.rg, tt.total, rec.Code, rec.Header().Get("Content-Range"), tt.status, tt.contentRange)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+// replicaRetryAfter is how long reads stay on the primary after the replica
+// reports an outage.
+const replicaRetryAfter = 30 * time.Second
+
+// ReadDB is the read-only replica connection, or nil when reads go to DB.
+var ReadDB *gorm.DB
+
+var replicaHealth struct {
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// replicaDSN derives the replica connection string from the primary one by
+// swapping in DB_READ_HOST and asking for a read-only session, so the
+// replica shares the primary's credentials. Setting DB_READ_HOST to the
+// primary host uses Azure SQL read scale-out.
+func replicaDSN(primary string) (string, error) {
+	u, err := url.Parse(primary)
+	if err != nil || u.Scheme != "sqlserver" {
+		return "", fmt.Errorf("cannot derive a replica DSN: the primary connection string is not a sqlserver:// URL")
+	}
+	port := u.Port()
+	if port == "" {
+		port = cfg.DBPort
+	}
+	u.Host = net.JoinHostPort(cfg.DBReadHost, port)
+	q := u.Query()
+	q.Set("ApplicationIntent", "ReadOnly")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// initReadReplica opens the replica when DB_READ_HOST is set. Failing to
+// reach it is not fatal: reads simply stay on the primary.
+func initReadReplica(primaryDSN string) {
+	if cfg.DBReadHost == "" {
+		return
+	}
+	dsn, err := replicaDSN(primaryDSN)
+	if err != nil {
+		log.Printf("WARNING: %v; serving reads from the primary", err)
+		return
+	}
+	db, err := gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
+	if err != nil {
+		log.Printf("WARNING: failed to connect to read replica %s: %v; serving reads from the primary", cfg.DBReadHost, err)
+		return
+	}
+	hook := func(tx *gorm.DB) {
+		if tx.Statement.Context.Err() == nil && isDBOutage(tx.Error) {
+			markReplicaDown(tx.Error)
+		}
+	}
+	cb := db.Callback()
+	if err := cb.Query().After("gorm:query").Register("replica:health", hook); err != nil {
+		log.Fatalf("failed to register read replica callbacks: %v", err)
+	}
+	if err := cb.Row().After("gorm:row").Register("replica:health", hook); err != nil {
+		log.Fatalf("failed to register read replica callbacks: %v", err)
+	}
+	if cfg.Debug {
+		if err := countQueries(db); err != nil {
+			log.Fatalf("failed to register query count callbacks: %v", err)
+		}
+	}
+	ReadDB = db
+	log.Printf("INFO serving reads from replica %s", cfg.DBReadHost)
+}
+
+func markReplicaDown(err error) {
+	replicaHealth.mu.Lock()
+	defer replicaHealth.mu.Unlock()
+	if time.Now().Before(replicaHealth.downUntil) {
+		return
+	}
+	replicaHealth.downUntil = time.Now().Add(replicaRetryAfter)
+	log.Printf("WARNING: read replica unavailable (%v); serving reads from the primary for %s", err, replicaRetryAfter)
+}
+
+func replicaUp() bool {
+	replicaHealth.mu.Lock()
+	defer replicaHealth.mu.Unlock()
+	return time.Now().After(replicaHealth.downUntil)
+}
+
+// readDBFor is dbFor for handlers that only read: it prefers the replica,
+// except inside a /batch transaction, which must see its own writes. The
+// replica may lag the primary slightly, so a read straight after a write
+// can return the previous version.
+func readDBFor(r *http.Request) *gorm.DB {
+	if inBatch(r) || ReadDB == nil || !replicaUp() {
+		return dbFor(r)
+	}
+	return ReadDB.WithContext(r.Context())
+}
+
+// readWithFallback runs read against readDBFor(r) and, if the replica fails
+// it, once more against the primary, so a replica that errors costs a slower
+// response rather than a 500. A transient error on the primary is then
+// retried up to -read-retries times, with a short pause between attempts.
+// read must reset whatever it fills in. Not-found results and reads cut off
+// by their context are not retried, nor are reads inside a /batch
+// transaction, which the error has already doomed. Only handlers that just
+// read use this; writes are never retried.
+func readWithFallback(r *http.Request, read func(db *gorm.DB) error) error {
+	db := readDBFor(r)
+	err := read(db)
+	if !retryableRead(r, err) {
+		return err
+	}
+	if onReplica(db) {
+		log.Printf("WARNING: read replica query failed (%v); retrying on the primary", err)
+		if err = read(dbFor(r)); !retryableRead(r, err) {
+			return err
+		}
+	}
+	if inBatch(r) {
+		return err
+	}
+	for attempt := 1; attempt <= cfg.ReadRetries && isTransientDBError(err); attempt++ {
+		if dbBreaker != nil && dbBreaker.State() == breakerOpen {
+			break // the database is down; retrying only delays the 503s
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * readRetryDelay):
+		case <-r.Context().Done():
+			return err
+		}
+		log.Printf("WARNING: %s %s: transient database error (%v); retry %d of %d", r.Method, r.URL.Path, err, attempt, cfg.ReadRetries)
+		if err = read(dbFor(r)); !retryableRead(r, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// readRetryDelay is the pause before the first retry of a read; later
+// retries wait proportionally longer.
+const readRetryDelay = 100 * time.Millisecond
+
+// retryableRead reports whether a failed read may be run again.
+func retryableRead(r *http.Request, err error) bool {
+	return err != nil && !errors.Is(err, gorm.ErrRecordNotFound) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil
+}
+
+// onReplica reports whether db is a session on ReadDB.
+func onReplica(db *gorm.DB) bool {
+	return ReadDB != nil && db.ConnPool == ReadDB.ConnPool
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestReadWithFallbackRetriesOnPrimary(t *testing.T) {
+	savedDB, savedRead := DB, ReadDB
+	t.Cleanup(func() { DB, ReadDB = savedDB, savedRead })
+	DB, ReadDB = dryRunDB(t), dryRunDB(t)
+	replicaHealth.downUntil = time.Time{}
+
+	for _, tt := range []struct {
+		name      string
+		replica   error
+		wantCalls int
+	}{
+		{"success", nil, 1},
+		{"replica error", driver.ErrBadConn, 2},
+		{"not found", gorm.ErrRecordNotFound, 1},
+	} {
+		var calls []bool
+		err := readWithFallback(httptest.NewRequest("GET", "/books", nil), func(db *gorm.DB) error {
+			calls = append(calls, onReplica(db))
+			if onReplica(db) {
+				return tt.replica
+			}
+			return nil
+		})
+		if len(calls) != tt.wantCalls || !calls[0] {
+			t.Errorf("%s: on replica per call = %v, want %d calls starting on the replica", tt.name, calls, tt.wantCalls)
+		}
+		if tt.wantCalls == 2 && (calls[1] || err != nil) {
+			t.Errorf("%s: retry on replica = %t, err = %v; want a successful retry on the primary", tt.name, calls[1], err)
+		}
+	}
+}
+
+func TestCountCacheRefillsFromPrimary(t *testing.T) {
+	withConfig(t)
+	savedDB, savedRead, savedCounts := DB, ReadDB, bookCounts
+	t.Cleanup(func() { DB, ReadDB, bookCounts = savedDB, savedRead, savedCounts })
+	DB, ReadDB = dryRunDB(t), dryRunDB(t)
+	primary, replica := captureSQL(t, DB), captureSQL(t, ReadDB)
+
+	bookCounts = newCountCache(time.Minute)
+	countBooks(httptest.NewRequest("GET", "/books/count", nil), BookQuery{})
+	if len(*primary) != 1 || len(*replica) != 0 {
+		t.Fatalf("cached count ran %d statements on the primary and %d on the replica, want 1 and 0", len(*primary), len(*replica))
+	}
+
+	bookCounts = nil
+	countBooks(httptest.NewRequest("GET", "/books/count", nil), BookQuery{})
+	if len(*replica) != 1 {
+		t.Fatalf("uncached count ran %d statements on the replica, want 1", len(*replica))
+	}
+}
+
+func TestReadWithFallbackRetriesTransientErrors(t *testing.T) {
+	withConfig(t)
+	savedDB, savedRead := DB, ReadDB
+	t.Cleanup(func() { DB, ReadDB = savedDB, savedRead })
+	DB, ReadDB = dryRunDB(t), nil
+	batch := context.WithValue(context.Background(), txKey{}, DB)
+
+	for _, tt := range []struct {
+		name      string
+		retries   int
+		ctx       context.Context
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"transient then success", 2, context.Background(), []error{driver.ErrBadConn, driver.ErrBadConn}, 3, false},
+		{"retries exhausted", 1, context.Background(), []error{driver.ErrBadConn, driver.ErrBadConn}, 2, true},
+		{"retries disabled", 0, context.Background(), []error{driver.ErrBadConn}, 1, true},
+		{"not transient", 2, context.Background(), []error{errors.New("Invalid column name 'x'")}, 1, true},
+		{"inside a batch", 2, batch, []error{driver.ErrBadConn}, 1, true},
+	} {
+		cfg.ReadRetries = tt.retries
+		calls := 0
+		err := readWithFallback(httptest.NewRequest("GET", "/books", nil).WithContext(tt.ctx), func(db *gorm.DB) error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != tt.wantCalls || (err != nil) != tt.wantErr {
+			t.Errorf("%s: %d calls, err = %v; want %d calls, error %t", tt.name, calls, err, tt.wantCalls, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const contentTypeJSON = "application/json; charset=utf-8"
+
+// respondJSON writes v as a UTF-8 JSON body with the given status code.
+// HTML escaping is disabled so titles such as "Tom & Jerry" or "Café <Noir>"
+// reach clients as written instead of as &-style escapes; encoding/json
+// already emits non-ASCII characters as raw UTF-8. With -json-naming=camel
+// the keys are rewritten to camelCase. Book data goes through respondBooks
+// instead, which can also answer in MessagePack.
+func respondJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := encodeJSON(v)
+	if err != nil {
+		log.Printf("failed to encode response: %v", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// encodeJSON is the encoding respondJSON writes, newline included.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	if cfg.JSONNaming == namingCamel {
+		renamed, err := renameJSON(data, snakeToCamel)
+		if err != nil {
+			return nil, err
+		}
+		data = append(renamed, '\n')
+	}
+	return data, nil
+}
+
+// defaultAccept gives requests without an Accept header, or with only
+// */*, the -default-accept value, so that clients such as curl get a fixed
+// representation and everything downstream (profiles, ETags, Vary) sees the
+// same header. An explicit Accept is left alone.
+func defaultAccept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accept := strings.TrimSpace(r.Header.Get("Accept")); accept == "" || accept == "*/*" {
+			r.Header.Set("Accept", cfg.DefaultAccept)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasProfile reports whether the Accept header asks for the named profile on
+// a JSON media range, e.g. `application/json; profile="envelope"`. Several
+// profiles may be listed in one parameter, separated by spaces.
+func hasProfile(r *http.Request, name string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil || mediaType != "application/json" {
+			continue
+		}
+		for _, p := range strings.Fields(params["profile"]) {
+			if p == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// profileSummary asks for bookSummary instead of the full book, e.g.
+// `Accept: application/json; profile=summary`. It combines with the envelope
+// profile as profile="envelope summary".
+const profileSummary = "summary"
+
+// bookSummary is the summary representation of a book, for list-heavy views
+// that only show the title, author and price.
+type bookSummary struct {
+	ID       uint    `json:"id"`
+	BookName string  `json:"book_name"`
+	Author   string  `json:"author,omitempty"`
+	Price    float64 `json:"price,omitempty"`
+}
+
+func summarizeBook(b Book) bookSummary {
+	return bookSummary{ID: b.ID, BookName: b.BookName, Author: b.Author, Price: b.Price}
+}
+
+func summarizeBooks(books []Book) []bookSummary {
+	out := make([]bookSummary, len(books))
+	for i, b := range books {
+		out[i] = summarizeBook(b)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHasProfile(t *testing.T) {
+	tests := []struct {
+		accept   string
+		envelope bool
+		summary  bool
+	}{
+		{"", false, false},
+		{"application/json", false, false},
+		{"application/json; profile=summary", false, true},
+		{`application/json; profile="envelope summary"`, true, true},
+		{`text/html, application/json;profile="envelope"`, true, false},
+		{"application/xml; profile=summary", false, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/books", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := hasProfile(r, "envelope"); got != tt.envelope {
+			t.Errorf("Accept %q: envelope = %t, want %t", tt.accept, got, tt.envelope)
+		}
+		if got := hasProfile(r, profileSummary); got != tt.summary {
+			t.Errorf("Accept %q: summary = %t, want %t", tt.accept, got, tt.summary)
+		}
+	}
+}
+
+func TestDefaultAccept(t *testing.T) {
+	withConfig(t)
+	cfg.DefaultAccept = `application/json; profile="envelope"`
+	tests := []struct {
+		accept []string
+		want   string
+	}{
+		{nil, `application/json; profile="envelope"`},
+		{[]string{""}, `application/json; profile="envelope"`},
+		{[]string{"*/*"}, `application/json; profile="envelope"`},
+		{[]string{"application/json"}, "application/json"},
+		{[]string{"application/json; profile=summary"}, "application/json; profile=summary"},
+		{[]string{"text/html, */*;q=0.8"}, "text/html, */*;q=0.8"},
+	}
+	for _, tt := range tests {
+		var got string
+		handler := defaultAccept(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Get("Accept")
+		}))
+		r := httptest.NewRequest("GET", "/books", nil)
+		for _, v := range tt.accept {
+			r.Header.Add("Accept", v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("Accept %q: handler saw %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// maxBulkRestoreIDs keeps a restore within one IN list on SQL Server.
+const maxBulkRestoreIDs = 1000
+
+type bulkRestoreResponse struct {
+	Restored    []uint `json:"restored"`
+	NotRestored []uint `json:"not_restored"`
+}
+
+// BulkRestoreBooks serves POST /books/bulk-restore. It takes {"ids": [...]}
+// and clears DeletedAt on those that are currently soft-deleted, all in one
+// transaction. Ids that are active or do not exist are reported under
+// not_restored. Admin-only.
+func BulkRestoreBooks(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	var req struct {
+		IDs []uint `json:"ids"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		http.Error(w, "ids must not be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.IDs) > maxBulkRestoreIDs {
+		http.Error(w, fmt.Sprintf("at most %d ids may be restored at once", maxBulkRestoreIDs), http.StatusBadRequest)
+		return
+	}
+
+	resp := bulkRestoreResponse{Restored: []uint{}, NotRestored: []uint{}}
+	err := dbFor(r).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&Book{}).
+			Where("id IN ? AND deleted_at IS NOT NULL", req.IDs).
+			Pluck("id", &resp.Restored).Error; err != nil {
+			return err
+		}
+		if len(resp.Restored) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Model(&Book{}).
+			Where("id IN ?", resp.Restored).
+			Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		// Restoring a book whose ISBN an active book has taken since.
+		if errs := constraintErrors(err); errs != nil {
+			respondValidation(w, errs)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	restored := make(map[uint]bool, len(resp.Restored))
+	for _, id := range resp.Restored {
+		restored[id] = true
+	}
+	for _, id := range req.IDs {
+		if !restored[id] {
+			resp.NotRestored = append(resp.NotRestored, id)
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
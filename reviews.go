@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// Review is a reader's rating of a book, from 1 to 5.
+type Review struct {
+	gorm.Model
+	BookID  uint   `json:"book_id" gorm:"index"`
+	Rating  int    `json:"rating"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// bookRatings is a derived table of the average rating per reviewed book,
+// joined into list queries as "ratings".
+const bookRatings = "(SELECT book_id, AVG(CAST(rating AS FLOAT)) AS avg_rating FROM reviews WHERE deleted_at IS NULL GROUP BY book_id)"
+
+// maxSummaryIDs keeps the IN list of GetReviewSummaries well under SQL
+// Server's 2100 parameter limit.
+const maxSummaryIDs = 1000
+
+type reviewSummary struct {
+	Avg   *float64 `json:"avg"`
+	Count int64    `json:"count"`
+}
+
+// GetReviewSummaries serves POST /books/review-summaries. The body is
+// {"ids": [1, 2, 3]} and the answer maps each id to its average rating and
+// review count, {"1": {"avg": 4.5, "count": 2}, ...}, from one grouped
+// query, so a list page can show ratings without a request per book. Books
+// without reviews, or that do not exist, have a null avg and count 0.
+func GetReviewSummaries(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	var body struct {
+		IDs []uint `json:"ids"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if len(body.IDs) > maxSummaryIDs {
+		http.Error(w, fmt.Sprintf("at most %d ids are allowed", maxSummaryIDs), http.StatusBadRequest)
+		return
+	}
+
+	summaries := make(map[uint]reviewSummary, len(body.IDs))
+	for _, id := range body.IDs {
+		summaries[id] = reviewSummary{}
+	}
+	if len(body.IDs) > 0 {
+		var rows []struct {
+			BookID uint
+			Avg    *float64
+			Count  int64
+		}
+		err := readWithFallback(r, func(db *gorm.DB) error {
+			rows = nil
+			return db.Model(&Review{}).
+				Select("book_id, AVG(CAST(rating AS FLOAT)) AS avg, COUNT(*) AS count").
+				Where("book_id IN ?", body.IDs).
+				Group("book_id").
+				Scan(&rows).Error
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, row := range rows {
+			summaries[row.BookID] = reviewSummary{Avg: row.Avg, Count: row.Count}
+		}
+	}
+	respondJSON(w, http.StatusOK, summaries)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReviewSummariesOneQuery(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	DB = dryRunDB(t)
+	stmts := captureSQL(t, DB)
+
+	rec := httptest.NewRecorder()
+	GetReviewSummaries(rec, httptest.NewRequest("POST", "/books/review-summaries", strings.NewReader(`{"ids":[1,2,3]}`)))
+	if len(*stmts) != 1 || !strings.Contains((*stmts)[0], "GROUP BY") || !strings.Contains((*stmts)[0], "book_id IN") {
+		t.Errorf("statements = %q, want one grouped query", *stmts)
+	}
+
+	rec = httptest.NewRecorder()
+	ids := strings.Repeat("1,", maxSummaryIDs) + "1"
+	GetReviewSummaries(rec, httptest.NewRequest("POST", "/books/review-summaries", strings.NewReader(`{"ids":[`+ids+`]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d for %d ids, want 400", rec.Code, maxSummaryIDs+1)
+	}
+}
+
+func TestReviewSummaries(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	books := []Book{{BookName: "Rated"}, {BookName: "Unrated"}}
+	if err := db.Create(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	reviews := []Review{{BookID: books[0].ID, Rating: 4}, {BookID: books[0].ID, Rating: 5}}
+	if err := db.Create(&reviews).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string][]uint{"ids": {books[0].ID, books[1].ID}})
+	rec := httptest.NewRecorder()
+	GetReviewSummaries(rec, httptest.NewRequest("POST", "/books/review-summaries", strings.NewReader(string(body))))
+	var got map[uint]reviewSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	rated, unrated := got[books[0].ID], got[books[1].ID]
+	if rated.Count != 2 || rated.Avg == nil || *rated.Avg != 4.5 {
+		t.Errorf("rated book = %+v, want avg 4.5 over 2", rated)
+	}
+	if unrated.Count != 0 || unrated.Avg != nil {
+		t.Errorf("unrated book = %+v, want null avg and count 0", unrated)
+	}
+}
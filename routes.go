@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+type routeInfo struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// registeredRoutes lists router's path templates with their methods, sorted
+// by path. Routes sharing a template, such as GET and PUT /book/{id}, are
+// merged; subrouters, which have no template of their own, are skipped.
+func registeredRoutes(router *mux.Router) []routeInfo {
+	methods := map[string][]string{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		ms, err := route.GetMethods()
+		if err != nil {
+			ms = []string{"*"} // matches any method
+		}
+		for _, m := range ms {
+			if !slices.Contains(methods[tmpl], m) {
+				methods[tmpl] = append(methods[tmpl], m)
+			}
+		}
+		return nil
+	})
+	routes := make([]routeInfo, 0, len(methods))
+	for tmpl, ms := range methods {
+		sort.Strings(ms)
+		routes = append(routes, routeInfo{Path: tmpl, Methods: ms})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	return routes
+}
+
+// listRoutes serves GET /admin/routes: every route router has mounted, so
+// operators can check which optional endpoints an instance actually serves.
+// Admin-only.
+func listRoutes(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		respondJSON(w, http.StatusOK, registeredRoutes(router))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestListRoutes(t *testing.T) {
+	withConfig(t)
+	cfg.AdminToken = "secret"
+	router := newRouter()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/routes", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without the token: %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/routes", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var routes []routeInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	got := map[string][]string{}
+	for i, route := range routes {
+		if i > 0 && routes[i-1].Path >= route.Path {
+			t.Errorf("routes not sorted: %s before %s", routes[i-1].Path, route.Path)
+		}
+		got[route.Path] = route.Methods
+	}
+	for path, want := range map[string][]string{
+		"/book/{id:[0-9]+}": {"DELETE", "GET", "PUT"},
+		"/books":            {"GET", "POST"},
+		"/books/backup.zip": {"GET", "HEAD"},
+		"/admin/routes":     {"GET"},
+	} {
+		if !reflect.DeepEqual(got[path], want) {
+			t.Errorf("%s methods = %v, want %v", path, got[path], want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	modelType     = reflect.TypeOf(gorm.Model{})
+)
+
+// bookSchema builds a JSON Schema (draft 2020-12) for Book by reflection,
+// translating the validate tags into schema keywords. Fields that come
+// from gorm.Model are marked readOnly.
+func bookSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	addSchemaFields(reflect.TypeOf(Book{}), false, properties, &required)
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Book",
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func addSchemaFields(t reflect.Type, readOnly bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addSchemaFields(f.Type, readOnly || f.Type == modelType, properties, required)
+			continue
+		}
+		name := apiName(jsonName(f))
+		prop := schemaType(f.Type)
+		if readOnly {
+			prop["readOnly"] = true
+		}
+		for _, rule := range fieldRules(f.Tag.Get("validate")) {
+			switch rule.Name {
+			case "required":
+				*required = append(*required, name)
+			case "maxlen":
+				prop["maxLength"], _ = strconv.Atoi(rule.Value)
+			case "min":
+				prop["minimum"], _ = strconv.ParseFloat(rule.Value, 64)
+			case "max":
+				prop["maximum"], _ = strconv.ParseFloat(rule.Value, 64)
+			case "isbn":
+				prop["pattern"] = `^([0-9]{9}[0-9X]|[0-9]{13})$`
+			case "currency":
+				prop["pattern"] = `^[A-Z]{3}$`
+			}
+		}
+		properties[name] = prop
+	}
+}
+
+func schemaType(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == deletedAtType:
+		return map[string]interface{}{"type": []string{"string", "null"}, "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{}
+}
+
+// GetBookSchema serves GET /schema/book, for clients that generate forms.
+func GetBookSchema(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, bookSchema())
+}
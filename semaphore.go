@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// dbSlots bounds the number of in-flight database operations. Waiters are
+// served in FIFO order, so a heavy request cannot be starved by a stream of
+// light ones.
+var dbSlots *semaphore.Weighted
+
+// limitDBConcurrency queues requests once -db-max-concurrent operations are
+// in flight, answering 503 if a slot does not free up within
+// -db-queue-timeout. This applies backpressure before Azure SQL runs out of
+// connections, independently of the pool size. Operations dispatched inside
+// a /batch transaction already hold the batch's slot.
+func limitDBConcurrency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inBatch(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.DBQueueTimeout)
+		defer cancel()
+		if err := dbSlots.Acquire(ctx, 1); err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Server busy, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		defer dbSlots.Release(1)
+		next.ServeHTTP(w, r)
+	})
+}
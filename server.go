@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// serve listens on -port, over HTTPS when -tls-cert and -tls-key are set,
+// and with -http-redirect-port also answers plain HTTP with a redirect. When
+// ctx is done it drains: readiness fails for -drain-delay so load balancers
+// stop routing here, then the servers shut down, giving in-flight requests
+// up to -shutdown-timeout to finish. It returns nil after a clean shutdown.
+func serve(ctx context.Context, handler http.Handler) error {
+	servers := []*http.Server{{Addr: ":" + cfg.Port, Handler: handler}}
+	if cfg.TLSCert != "" && cfg.HTTPRedirectPort != "" {
+		servers = append(servers, &http.Server{Addr: ":" + cfg.HTTPRedirectPort, Handler: http.HandlerFunc(redirectToHTTPS)})
+	}
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func() {
+			if i == 0 && cfg.TLSCert != "" {
+				errs <- srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+			} else {
+				errs <- srv.ListenAndServe()
+			}
+		}()
+	}
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	appState.drain()
+	log.Printf("INFO shutting down: draining for %s", cfg.DrainDelay)
+	time.Sleep(cfg.DrainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("shutting down %s: %w", srv.Addr, err)
+		}
+	}
+	log.Print("INFO shutdown complete")
+	return nil
+}
+
+// serverHandler wraps the router for the listener: errors become problem
+// details for clients that ask (see problemDetails). With -h2c, connections
+// that start with the HTTP/2 preface (prior knowledge) or ask to upgrade are
+// served as HTTP/2 without TLS, letting a client or an L7 proxy multiplex
+// many requests over one connection; anything else is handled as HTTP/1.1.
+// Only enable it where TLS is terminated in front of the service.
+func serverHandler(router http.Handler) http.Handler {
+	handler := problemDetails(router)
+	if cfg.HSTSMaxAge > 0 {
+		handler = strictTransportSecurity(handler)
+	}
+	if cfg.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	return handler
+}
+
+// strictTransportSecurity sends HSTS on responses to HTTPS requests, either
+// terminated here or, behind a proxy, marked with X-Forwarded-Proto. Browsers
+// ignore the header over plain HTTP, so it is not sent there.
+func strictTransportSecurity(next http.Handler) http.Handler {
+	value := "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge.Seconds()), 10)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS
+// port. GET and HEAD get a 301; other methods a 308, since clients replay a
+// redirected POST or PUT as a GET after a 301.
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if cfg.Port != "443" {
+		host = net.JoinHostPort(host, cfg.Port)
+	}
+	status := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
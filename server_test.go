@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func TestServerHandlerH2C(t *testing.T) {
+	withConfig(t)
+	for _, h2cOn := range []bool{false, true} {
+		cfg.H2C = h2cOn
+		srv := httptest.NewServer(serverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Proto", r.Proto)
+		})))
+
+		// HTTP/1.1 is served either way.
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.Header.Get("X-Proto") != "HTTP/1.1" {
+			t.Errorf("h2c=%t: HTTP/1.1 client served as %s", h2cOn, resp.Header.Get("X-Proto"))
+		}
+
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}
+		resp, err = client.Get(srv.URL)
+		if h2cOn {
+			if err != nil {
+				t.Fatalf("h2c request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.ProtoMajor != 2 || resp.Header.Get("X-Proto") != "HTTP/2.0" {
+				t.Errorf("h2c request served as %s", resp.Header.Get("X-Proto"))
+			}
+		} else if err == nil {
+			resp.Body.Close()
+			t.Errorf("prior-knowledge HTTP/2 accepted without -h2c")
+		}
+		srv.Close()
+	}
+}
+
+func TestStrictTransportSecurity(t *testing.T) {
+	withConfig(t)
+	cfg.HSTSMaxAge = 365 * 24 * time.Hour
+	handler := serverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	plain := httptest.NewRecorder()
+	handler.ServeHTTP(plain, httptest.NewRequest("GET", "http://example.com/books", nil))
+	if got := plain.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("plain HTTP got Strict-Transport-Security %q", got)
+	}
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "https://example.com/books", nil),
+		func() *http.Request {
+			r := httptest.NewRequest("GET", "http://example.com/books", nil)
+			r.Header.Set("X-Forwarded-Proto", "https")
+			return r
+		}(),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+			t.Errorf("%s (forwarded %q): Strict-Transport-Security = %q", req.URL, req.Header.Get("X-Forwarded-Proto"), got)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	withConfig(t)
+	tests := []struct {
+		port, method, url string
+		status            int
+		location          string
+	}{
+		{"443", "GET", "http://example.com:8080/books?page=2", http.StatusMovedPermanently, "https://example.com/books?page=2"},
+		{"8443", "GET", "http://example.com/book/1", http.StatusMovedPermanently, "https://example.com:8443/book/1"},
+		{"443", "POST", "http://example.com/books", http.StatusPermanentRedirect, "https://example.com/books"},
+	}
+	for _, tt := range tests {
+		cfg.Port = tt.port
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(rec, httptest.NewRequest(tt.method, tt.url, nil))
+		if rec.Code != tt.status || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s: %d %q, want %d %q", tt.method, tt.url, rec.Code, rec.Header().Get("Location"), tt.status, tt.location)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type priceStats struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+	Avg *float64 `json:"avg"`
+}
+
+// bookStats holds the dashboard aggregates. Sections that did not finish
+// within the time budget are left out and listed under Missing.
+type bookStats struct {
+	Count      *int64          `json:"count,omitempty"`
+	Price      *priceStats     `json:"price,omitempty"`
+	Genres     []distinctValue `json:"genres,omitempty"`
+	Currencies []distinctValue `json:"currencies,omitempty"`
+	AvgRating  *float64        `json:"avg_rating,omitempty"`
+	Missing    []string        `json:"missing,omitempty"`
+}
+
+// GetBookStats serves GET /books/stats with the same filters as GetBooks.
+// The aggregates run one after another within -stats-budget; once the
+// budget is spent the remaining ones are skipped and the response carries
+// what was computed so far with X-Partial: true, rather than failing.
+func GetBookStats(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+
+	ctx, cancel := statsContext(r)
+	defer cancel()
+
+	// With -stats-totals the unfiltered count and average price come from
+	// memory; MIN and MAX still query, but only seek the price index.
+	total, priced, priceSum, cached := cachedTotals(r, bq)
+	var stats bookStats
+	sections := []struct {
+		name string
+		run  func(books *gorm.DB) error
+	}{
+		{"count", func(books *gorm.DB) error {
+			if cached {
+				stats.Count = &total
+				return nil
+			}
+			var n int64
+			if err := books.Count(&n).Error; err != nil {
+				return err
+			}
+			stats.Count = &n
+			return nil
+		}},
+		{"price", func(books *gorm.DB) error {
+			var p priceStats
+			if cached {
+				if err := books.Select("MIN(price), MAX(price)").Row().Scan(&p.Min, &p.Max); err != nil {
+					return err
+				}
+				if priced > 0 {
+					avg := priceSum / float64(priced)
+					p.Avg = &avg
+				}
+				stats.Price = &p
+				return nil
+			}
+			if err := books.Select("MIN(price), MAX(price), AVG(price)").Row().Scan(&p.Min, &p.Max, &p.Avg); err != nil {
+				return err
+			}
+			stats.Price = &p
+			return nil
+		}},
+		{"genres", func(books *gorm.DB) error {
+			return groupCounts(books, "genre", &stats.Genres)
+		}},
+		{"currencies", func(books *gorm.DB) error {
+			return groupCounts(books, "currency", &stats.Currencies)
+		}},
+		{"avg_rating", func(books *gorm.DB) error {
+			var avg *float64
+			err := books.Joins("JOIN reviews ON reviews.book_id = books.id AND reviews.deleted_at IS NULL").
+				Select("AVG(CAST(reviews.rating AS FLOAT))").Row().Scan(&avg)
+			if err != nil {
+				return err
+			}
+			stats.AvgRating = avg
+			return nil
+		}},
+	}
+	for _, s := range sections {
+		if ctx.Err() == nil {
+			err := readWithFallback(r, func(db *gorm.DB) error {
+				return s.run(bq.Apply(db.WithContext(ctx)))
+			})
+			if err != nil && ctx.Err() == nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		// Checked again after running: a query cut off by the budget
+		// leaves its section unset.
+		if ctx.Err() != nil {
+			if r.Context().Err() != nil {
+				return // the client is gone
+			}
+			stats.Missing = append(stats.Missing, s.name)
+		}
+	}
+	if len(stats.Missing) > 0 {
+		w.Header().Set("X-Partial", "true")
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// groupCounts counts books per value of column, with missing values as "".
+func groupCounts(db *gorm.DB, column string, dest *[]distinctValue) error {
+	expr := "COALESCE(" + column + ", '')"
+	*dest = []distinctValue{}
+	return db.Select(expr + " AS value, COUNT(*) AS count").Group(expr).Order(expr).Scan(dest).Error
+}
+
+// statsContext bounds an aggregate endpoint by -stats-budget. A handler
+// whose query is cut off by it answers with what it has and X-Partial: true.
+func statsContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), cfg.StatsBudget)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// bookTotals keeps the number of active books, how many of them have a
+// price and the sum of those prices in memory, so the unfiltered
+// /books/stats does not aggregate the table on every call. The average is
+// the sum over the priced books, the rows AVG(price) counts. CreateBook, UpdateBook and DeleteBook adjust it once their
+// transaction has committed; any other write to books (imports, bulk
+// restores, price adjustments) marks it invalid, and stats fall back to SQL
+// until the next reconcile recomputes it from the database.
+//
+// Reconciling races with writes, so a reconcile only takes effect when no
+// counted write was in flight while it read the table; otherwise it is
+// dropped and the next run tries again. A bulk write still uncommitted when
+// a reconcile reads the table is corrected by the run after.
+type bookTotals struct {
+	mu       sync.Mutex
+	valid    bool
+	count    int64
+	priced   int64 // books whose price is not NULL
+	priceSum float64
+	pending  int    // counted writes begun but not yet applied
+	writes   uint64 // bumped by every write, counted or not
+}
+
+var totals *bookTotals
+
+// countedKey marks a statement whose effect on the totals its handler
+// applies itself, so the write callbacks leave the totals valid.
+const countedKey = "book_totals:counted"
+
+// totalsDelta is a counted write's effect on the totals.
+type totalsDelta struct {
+	count  int64
+	priced int64
+	price  float64
+}
+
+// bookDelta is the effect of adding (n = 1) or removing (n = -1) an active
+// book with the given price, nil for NULL.
+func bookDelta(n int64, price *float64) totalsDelta {
+	d := totalsDelta{count: n}
+	if price != nil {
+		d.priced, d.price = n, float64(n)**price
+	}
+	return d
+}
+
+func (d totalsDelta) add(e totalsDelta) totalsDelta {
+	return totalsDelta{count: d.count + e.count, priced: d.priced + e.priced, price: d.price + e.price}
+}
+
+// get returns the totals, or false when they are not trustworthy.
+func (t *bookTotals) get() (count, priced int64, priceSum float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count, t.priced, t.priceSum, t.valid
+}
+
+func (t *bookTotals) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending++
+	t.writes++
+}
+
+// end finishes a counted write. Inside /batch the commit is still to come
+// and may roll back, so the totals are invalidated rather than adjusted.
+func (t *bookTotals) end(r *http.Request, err error, d totalsDelta) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending--
+	if inBatch(r) {
+		t.valid = false
+		return
+	}
+	if err == nil {
+		t.count += d.count
+		t.priced += d.priced
+		t.priceSum += d.price
+	}
+}
+
+func (t *bookTotals) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.valid = false
+	t.writes++
+}
+
+// Flush invalidates the totals until the next reconcile.
+func (t *bookTotals) Flush() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.valid {
+		return 0
+	}
+	t.valid = false
+	return 1
+}
+
+// Warm reconciles the totals with the database.
+func (t *bookTotals) Warm(ctx context.Context) error {
+	return t.reconcile(ctx, DB)
+}
+
+// reconcile recomputes the totals from db, logging any drift it corrects.
+func (t *bookTotals) reconcile(ctx context.Context, db *gorm.DB) error {
+	t.mu.Lock()
+	if t.pending > 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	writes := t.writes
+	t.mu.Unlock()
+
+	var row struct {
+		Count    int64
+		Priced   int64
+		PriceSum float64
+	}
+	err := db.WithContext(ctx).Model(&Book{}).
+		Select("COUNT(*) AS count, COUNT(price) AS priced, COALESCE(SUM(price), 0) AS price_sum").Scan(&row).Error
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending > 0 || t.writes != writes {
+		return nil
+	}
+	if t.valid && (t.count != row.Count || t.priced != row.Priced || math.Abs(t.priceSum-row.PriceSum) >= 0.005) {
+		log.Printf("WARNING: book totals drifted: count %d, priced %d, price sum %.2f in memory; %d, %d, %.2f in the database",
+			t.count, t.priced, t.priceSum, row.Count, row.Priced, row.PriceSum)
+	}
+	t.count, t.priced, t.priceSum, t.valid = row.Count, row.Priced, row.PriceSum, true
+	return nil
+}
+
+// reconcileEvery reconciles the totals every interval until ctx is done.
+func (t *bookTotals) reconcileEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.reconcile(ctx, DB); err != nil && ctx.Err() == nil {
+				log.Printf("WARNING: failed to reconcile book totals: %v", err)
+			}
+		}
+	}
+}
+
+// invalidateOnWrite registers GORM callbacks that invalidate the totals after
+// any create, update or delete on books that its handler does not count.
+func (t *bookTotals) invalidateOnWrite(db *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		if _, counted := tx.Get(countedKey); tx.Statement.Table == "books" && !counted {
+			t.invalidate()
+		}
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("book_totals:create", invalidate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("book_totals:update", invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("book_totals:delete", invalidate)
+}
+
+// countedWriteTx runs fn like writeTx and, once it has committed, applies
+// the delta fn returns to the totals. The statements fn issues on tx must be
+// the whole of the write's effect on those figures, and the delta must come
+// from rows read inside tx (see lockedPrice), not from an earlier read that
+// a concurrent write may have made stale.
+func countedWriteTx(r *http.Request, fn func(tx *gorm.DB) (totalsDelta, error)) error {
+	if totals == nil {
+		return writeTx(r, func(tx *gorm.DB) error {
+			_, err := fn(tx)
+			return err
+		})
+	}
+	totals.begin()
+	var d totalsDelta
+	err := writeTx(r, func(tx *gorm.DB) error {
+		var err error
+		d, err = fn(tx.Set(countedKey, true))
+		return err
+	})
+	totals.end(r, err, d)
+	return err
+}
+
+// lockedPrice reads the price of active book id, nil for NULL, and holds an
+// update lock on its row until tx ends, so a concurrent write to the same
+// book waits for this one. It returns gorm.ErrRecordNotFound when there is
+// no such book.
+func lockedPrice(tx *gorm.DB, id uint) (*float64, error) {
+	var rows []struct{ Price *float64 }
+	err := tx.Raw("SELECT price FROM books WITH (UPDLOCK) WHERE id = ? AND deleted_at IS NULL", id).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return rows[0].Price, nil
+}
+
+// cachedTotals returns the in-memory totals when they can stand in for
+// aggregating the books bq matches: unfiltered, outside a batch, and not
+// asked to be ?fresh.
+func cachedTotals(r *http.Request, bq BookQuery) (count, priced int64, priceSum float64, ok bool) {
+	if totals == nil || bq.Key() != "" || r.URL.Query().Get("fresh") == "true" {
+		return 0, 0, 0, false
+	}
+	if inBatch(r) {
+		return 0, 0, 0, false
+	}
+	return totals.get()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestBookTotalsApplyCommittedWrites(t *testing.T) {
+	req := httptest.NewRequest("POST", "/books", nil)
+	batch := req.WithContext(context.WithValue(req.Context(), txKey{}, dryRunDB(t)))
+
+	five, ten := 5.0, 10.0
+	tot := &bookTotals{valid: true, count: 2, priced: 2, priceSum: 20}
+	tot.begin()
+	tot.end(req, nil, bookDelta(1, &five))
+	tot.begin()
+	tot.end(req, nil, bookDelta(1, nil))
+	tot.begin()
+	tot.end(req, errors.New("constraint"), bookDelta(-1, &ten))
+	if count, priced, sum, ok := tot.get(); !ok || count != 4 || priced != 3 || sum != 25 {
+		t.Errorf("after two committed and a failed write: %d, %d, %v, %t; want 4, 3, 25, true", count, priced, sum, ok)
+	}
+
+	tot.begin()
+	tot.end(batch, nil, bookDelta(1, &five))
+	if _, _, _, ok := tot.get(); ok {
+		t.Error("totals still valid after a write whose batch may roll back")
+	}
+}
+
+func TestBookTotalsReconcileSkipsWritesInFlight(t *testing.T) {
+	db := dryRunDB(t)
+	tot := &bookTotals{valid: true, count: 7, priceSum: 70}
+
+	tot.begin()
+	if err := tot.reconcile(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if count, _, _, _ := tot.get(); count != 7 {
+		t.Errorf("reconcile with a write in flight set count %d, want it left at 7", count)
+	}
+}
+
+func TestBookTotalsInvalidatedByUncountedWrites(t *testing.T) {
+	db := dryRunDB(t)
+	tot := &bookTotals{valid: true}
+	if err := tot.invalidateOnWrite(db); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Set(countedKey, true).Create(&Book{BookName: "Counted"})
+	if _, _, _, ok := tot.get(); !ok {
+		t.Error("a counted write invalidated the totals")
+	}
+	db.Model(&Book{}).Where("genre = ?", "SF").Update("price", 1)
+	if _, _, _, ok := tot.get(); ok {
+		t.Error("an uncounted bulk update left the totals valid")
+	}
+}
+
+func TestCachedTotalsOnlyServeUnfilteredStats(t *testing.T) {
+	withConfig(t)
+	saved := totals
+	t.Cleanup(func() { totals = saved })
+	totals = &bookTotals{valid: true, count: 4, priced: 4, priceSum: 40}
+
+	for _, tt := range []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"?author=Herbert", false},
+		{"?include_deleted=true", false},
+		{"?fresh=true", false},
+	} {
+		r := httptest.NewRequest("GET", "/books/stats"+tt.query, nil)
+		bq, err := ParseBookFilters(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, ok := cachedTotals(r, bq); ok != tt.want {
+			t.Errorf("%q: served from memory = %t, want %t", tt.query, ok, tt.want)
+		}
+	}
+}
+
+func TestStatsFromTotalsMatchSQL(t *testing.T) {
+	withConfig(t)
+	testDB(t)
+	saved := totals
+	t.Cleanup(func() { totals = saved })
+	totals = &bookTotals{}
+	if err := totals.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"book_name":"One","price":10}`, `{"book_name":"Two","price":4}`} {
+		rec := httptest.NewRecorder()
+		CreateBook(rec, httptest.NewRequest("POST", "/books", strings.NewReader(body)))
+		if rec.Code != 200 {
+			t.Fatalf("create: %d %s", rec.Code, rec.Body)
+		}
+	}
+
+	// A book with a NULL price counts as a book but not towards AVG(price).
+	if err := DB.Exec("INSERT INTO books (created_at, updated_at, book_name) VALUES (SYSDATETIME(), SYSDATETIME(), 'Unpriced')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := totals.reconcile(context.Background(), DB); err != nil {
+		t.Fatal(err)
+	}
+	var one Book
+	if err := DB.Where("book_name = ?", "One").First(&one).Error; err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/book/1", strings.NewReader(`{"book_name":"One","price":6}`))
+	UpdateBook(rec, mux.SetURLVars(req, map[string]string{"id": fmt.Sprint(one.ID)}))
+	if rec.Code != 200 {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body)
+	}
+
+	stats := func(query string) string {
+		rec := httptest.NewRecorder()
+		GetBookStats(rec, httptest.NewRequest("GET", "/books/stats"+query, nil))
+		return rec.Body.String()
+	}
+	if count, priced, sum, ok := totals.get(); !ok || count != 3 || priced != 2 || sum != 10 {
+		t.Fatalf("totals = %d, %d, %v, %t; want 3, 2, 10, true", count, priced, sum, ok)
+	}
+	totals.invalidate()
+	if err := totals.reconcile(context.Background(), DB); err != nil {
+		t.Fatal(err)
+	}
+	if count, priced, sum, ok := totals.get(); !ok || count != 3 || priced != 2 || sum != 10 {
+		t.Errorf("reconciled totals = %d, %d, %v, %t; want 3, 2, 10, true", count, priced, sum, ok)
+	}
+	if fromMemory, fromSQL := stats(""), stats("?fresh=true"); fromMemory != fromSQL {
+		t.Errorf("stats from memory %s differ from SQL %s", fromMemory, fromSQL)
+	}
+}
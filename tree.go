@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+type treeBook struct {
+	ID       uint   `json:"id"`
+	BookName string `json:"book_name"`
+}
+
+type treeAuthor struct {
+	Author string     `json:"author"`
+	Books  []treeBook `json:"books"`
+}
+
+type treeGenre struct {
+	Genre   string       `json:"genre"`
+	Authors []treeAuthor `json:"authors"`
+}
+
+// Tree grouping keys. The fold in GetBookTree compares them byte for byte,
+// so the query must order them the same way: under the database's default
+// case-insensitive collation "Fantasy" and "fantasy" (or "Tolkien" and
+// "Tolkien ", since trailing spaces are ignored) sort as equal and would
+// interleave. Ordering by a binary collation keeps each exact spelling
+// contiguous; trailing spaces are trimmed so padding cannot split a group.
+const (
+	treeGenreKey  = "COALESCE(RTRIM(genre), '')"
+	treeAuthorKey = "COALESCE(RTRIM(author), '')"
+	treeCollation = " COLLATE Latin1_General_BIN2"
+)
+
+// GetBookTree serves GET /books/tree: books nested by genre, then author,
+// for the catalog sidebar. A single query ordered by genre, author and id
+// is folded into the tree as rows stream in, so the cost does not grow with
+// the number of authors. Missing genres and authors are grouped under "";
+// values that differ only in case are listed as separate groups.
+// Accepts the same filters as GetBooks.
+func GetBookTree(w http.ResponseWriter, r *http.Request) {
+	if DB == nil {
+		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+		return
+	}
+	bq, err := ParseBookFilters(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if bq.IncludeDeleted && !requireAdmin(w, r) {
+		return
+	}
+
+	var rows *sql.Rows
+	err = readWithFallback(r, func(db *gorm.DB) (err error) {
+		rows, err = bq.Apply(db).
+			Select("id, book_name, " + treeGenreKey + " AS genre, " + treeAuthorKey + " AS author").
+			Order(treeGenreKey + treeCollation + ", " + treeAuthorKey + treeCollation + ", id").
+			Rows()
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tree := []treeGenre{}
+	for rows.Next() {
+		var (
+			book          treeBook
+			genre, author string
+		)
+		if err := rows.Scan(&book.ID, &book.BookName, &genre, &author); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tree = addToTree(tree, genre, author, book)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, tree)
+}
+
+// addToTree appends book to tree, which is built from rows ordered by genre
+// and then author, starting a new group whenever either key changes.
+func addToTree(tree []treeGenre, genre, author string, book treeBook) []treeGenre {
+	if len(tree) == 0 || tree[len(tree)-1].Genre != genre {
+		tree = append(tree, treeGenre{Genre: genre})
+	}
+	g := &tree[len(tree)-1]
+	if len(g.Authors) == 0 || g.Authors[len(g.Authors)-1].Author != author {
+		g.Authors = append(g.Authors, treeAuthor{Author: author})
+	}
+	a := &g.Authors[len(g.Authors)-1]
+	a.Books = append(a.Books, book)
+	return tree
+}
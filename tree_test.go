@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBookTreeOrdersByBinaryCollation(t *testing.T) {
+	withConfig(t)
+	saved := DB
+	t.Cleanup(func() { DB = saved })
+	DB = dryRunDB(t)
+	stmts := captureSQL(t, DB)
+
+	GetBookTree(httptest.NewRecorder(), httptest.NewRequest("GET", "/books/tree", nil))
+	if len(*stmts) != 1 {
+		t.Fatalf("ran %d statements, want 1", len(*stmts))
+	}
+	want := "ORDER BY " + treeGenreKey + treeCollation + "," + treeAuthorKey + treeCollation + ",id"
+	if got := strings.ReplaceAll((*stmts)[0], ", ", ","); !strings.Contains(got, strings.ReplaceAll(want, ", ", ",")) {
+		t.Errorf("tree query %q does not order by %q", (*stmts)[0], want)
+	}
+}
+
+func TestAddToTreeGroupsExactSpellings(t *testing.T) {
+	rows := []struct {
+		genre, author string
+		id            uint
+	}{
+		{"Fantasy", "Tolkien", 1},
+		{"Fantasy", "Tolkien", 4},
+		{"Fantasy", "tolkien", 2},
+		{"fantasy", "Tolkien", 3},
+	}
+	var tree []treeGenre
+	for _, row := range rows {
+		tree = addToTree(tree, row.genre, row.author, treeBook{ID: row.id})
+	}
+	want := []treeGenre{
+		{Genre: "Fantasy", Authors: []treeAuthor{
+			{Author: "Tolkien", Books: []treeBook{{ID: 1}, {ID: 4}}},
+			{Author: "tolkien", Books: []treeBook{{ID: 2}}},
+		}},
+		{Genre: "fantasy", Authors: []treeAuthor{
+			{Author: "Tolkien", Books: []treeBook{{ID: 3}}},
+		}},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("tree = %+v, want %+v", tree, want)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation rules are declared on model fields with a `validate` tag, a
+// comma-separated list of:
+//
+//	required   the field must be non-empty
+//	maxlen=N   strings are at most N characters
+//	min=N      numbers are at least N
+//	max=N      numbers are at most N
+//	isbn       a valid ISBN-10 or ISBN-13, checksum included
+//	currency   a three-letter upper-case ISO 4217 code
+//
+// The same tags drive validateBook and the JSON Schema served at
+// /schema/book, so the two cannot drift apart.
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type validationErrors struct {
+	Errors []fieldError `json:"errors"`
+}
+
+type fieldRule struct {
+	Name  string
+	Value string
+}
+
+// fieldRules parses a validate tag.
+func fieldRules(tag string) []fieldRule {
+	if tag == "" {
+		return nil
+	}
+	var rules []fieldRule
+	for _, part := range strings.Split(tag, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		rules = append(rules, fieldRule{Name: name, Value: value})
+	}
+	return rules
+}
+
+// jsonName returns the JSON key of a struct field.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// validateBook checks b against the rules on Book's fields and returns one
+// error per failing rule.
+func validateBook(b Book) []fieldError {
+	var errs []fieldError
+	v := reflect.ValueOf(b)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		for _, rule := range fieldRules(f.Tag.Get("validate")) {
+			if msg := checkRule(rule, v.Field(i)); msg != "" {
+				errs = append(errs, fieldError{Field: apiName(jsonName(f)), Message: msg})
+			}
+		}
+	}
+	return errs
+}
+
+func checkRule(rule fieldRule, v reflect.Value) string {
+	switch rule.Name {
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+	case "maxlen":
+		n, _ := strconv.Atoi(rule.Value)
+		if v.Kind() == reflect.String && utf8.RuneCountInString(v.String()) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(rule.Value, 64)
+		var x float64
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			x = v.Float()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			x = float64(v.Int())
+		default:
+			return ""
+		}
+		if rule.Name == "min" && x < limit {
+			return "must be at least " + rule.Value
+		}
+		if rule.Name == "max" && x > limit {
+			return "must be at most " + rule.Value
+		}
+	case "isbn":
+		if s := v.String(); s != "" && !validISBN(s) {
+			return "must be a valid ISBN-10 or ISBN-13"
+		}
+	case "currency":
+		if s := v.String(); s != "" && !validCurrencyCode(s) {
+			return "must be a three-letter ISO 4217 code such as USD"
+		}
+	}
+	return ""
+}
+
+// validISBN checks the length and check digit of a normalized ISBN.
+func validISBN(s string) bool {
+	switch len(s) {
+	case 10:
+		sum := 0
+		for i, r := range s {
+			var d int
+			switch {
+			case r >= '0' && r <= '9':
+				d = int(r - '0')
+			case r == 'X' && i == 9:
+				d = 10
+			default:
+				return false
+			}
+			sum += d * (10 - i)
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i, r := range s {
+			if r < '0' || r > '9' {
+				return false
+			}
+			d := int(r - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
+func validCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// respondValidation writes a 422 listing the failing fields.
+func respondValidation(w http.ResponseWriter, errs []fieldError) {
+	respondJSON(w, http.StatusUnprocessableEntity, validationErrors{Errors: errs})
+}
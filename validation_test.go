@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+func TestValidISBN(t *testing.T) {
+	tests := []struct {
+		isbn string
+		want bool
+	}{
+		{"0261102362", true},
+		{"080442957X", true},
+		{"9780261102361", true},
+		{"9780261102362", false}, // bad check digit
+		{"0261102363", false},
+		{"X261102362", false}, // X only as the ISBN-10 check digit
+		{"978026110236X", false},
+		{"978-0261102361", false}, // not normalized
+		{"026110236", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validISBN(tt.isbn); got != tt.want {
+			t.Errorf("validISBN(%q) = %t, want %t", tt.isbn, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBook(t *testing.T) {
+	withConfig(t)
+	tests := []struct {
+		book   Book
+		fields []string
+	}{
+		{Book{BookName: "The Hobbit", Price: 9.99, Currency: "GBP", ISBN: "9780261102361"}, nil},
+		{Book{}, []string{"book_name"}},
+		{Book{BookName: "x", Price: -1, Currency: "gbp", ISBN: "123"}, []string{"price", "currency", "isbn"}},
+	}
+	for _, tt := range tests {
+		errs := validateBook(tt.book)
+		var fields []string
+		for _, e := range errs {
+			fields = append(fields, e.Field)
+		}
+		if len(fields) != len(tt.fields) {
+			t.Errorf("validateBook(%+v) fields = %q, want %q", tt.book, fields, tt.fields)
+			continue
+		}
+		for i := range fields {
+			if fields[i] != tt.fields[i] {
+				t.Errorf("validateBook(%+v) fields = %q, want %q", tt.book, fields, tt.fields)
+				break
+			}
+		}
+	}
+}
+
+func TestConstraintErrors(t *testing.T) {
+	withConfig(t)
+	tests := []struct {
+		err  error
+		want []fieldError
+	}{
+		{mssql.Error{Number: 515, Message: "Cannot insert the value NULL into column 'book_name', table 'projectdb.dbo.books'; column does not allow nulls. INSERT fails."},
+			[]fieldError{{"book_name", "is required"}}},
+		{mssql.Error{Number: 2628, Message: "String or binary data would be truncated in table 'projectdb.dbo.books', column 'genre'. Truncated value: 'aaaa'."},
+			[]fieldError{{"genre", "must be at most 100 characters"}}},
+		{mssql.Error{Number: 2601, Message: "Cannot insert duplicate key row in object 'dbo.books' with unique index 'idx_books_isbn'. The duplicate key value is (9780261102361)."},
+			[]fieldError{{"isbn", "must be unique; 9780261102361 is already taken"}}},
+		{mssql.Error{Number: 547, Message: `The INSERT statement conflicted with the CHECK constraint "chk_books_price". The conflict occurred in database "projectdb", table "dbo.books", column 'price'.`},
+			[]fieldError{{"price", "is not allowed by the chk_books_price constraint"}}},
+		{mssql.Error{Number: 2627, Message: "Violation of UNIQUE KEY constraint 'uq_unknown'. Cannot insert duplicate key in object 'dbo.books'."}, nil},
+		{mssql.Error{Number: 40613, Message: "Database 'projectdb' on server 'x' is not currently available."}, nil},
+		{errors.New("column 'book_name' is odd"), nil},
+	}
+	for _, tt := range tests {
+		if got := constraintErrors(tt.err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("constraintErrors(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// writeTx runs a handler's writes in one transaction bound to the request's
+// context. If the client disconnects before the transaction commits it is
+// rolled back, rather than committed for a caller who will never see the
+// result, and context.Canceled is returned. Inside /batch the writes join the
+// batch's transaction, which makes the same check before it commits.
+func writeTx(r *http.Request, fn func(tx *gorm.DB) error) error {
+	if tx, ok := batchTx(r); ok {
+		return fn(tx)
+	}
+	return DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return r.Context().Err()
+	})
+}
+
+// clientGone reports whether err is the request's own cancellation, in which
+// case there is nobody left to answer and the handler should just return.
+func clientGone(r *http.Request, err error) bool {
+	if r.Context().Err() == nil || !errors.Is(err, context.Canceled) {
+		return false
+	}
+	log.Printf("INFO %s %s: client disconnected, changes rolled back", r.Method, r.URL.Path)
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestClientGone(t *testing.T) {
+	r := httptest.NewRequest("POST", "/books", nil)
+	if clientGone(r, context.Canceled) {
+		t.Error("clientGone with a live request context = true")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = r.WithContext(ctx)
+	if clientGone(r, errors.New("boom")) {
+		t.Error("clientGone for an unrelated error = true")
+	}
+	if !clientGone(r, context.Canceled) {
+		t.Error("clientGone for the request's cancellation = false")
+	}
+}
+
+// disconnectAfterInsert cancels the returned context once an INSERT has run,
+// as if the client hung up while its transaction was still open.
+func disconnectAfterInsert(t *testing.T, db *gorm.DB) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	err := db.Callback().Create().After("gorm:create").Register("test:disconnect", func(tx *gorm.DB) {
+		if tx.Error == nil {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func TestCreateBookRollsBackWhenClientDisconnects(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	ctx := disconnectAfterInsert(t, db)
+	req := httptest.NewRequest("POST", "/books", strings.NewReader(`{"book_name":"Dune"}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	CreateBook(rec, req)
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("response written for a disconnected client: %d %s", rec.Code, rec.Body)
+	}
+	var n int64
+	if err := db.Model(&Book{}).Where("book_name = ?", "Dune").Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d books persisted after the client disconnected, want 0", n)
+	}
+}
+
+func TestBatchRollsBackWhenClientDisconnects(t *testing.T) {
+	withConfig(t)
+	db := testDB(t)
+	ctx := disconnectAfterInsert(t, db)
+	body := `[{"method":"POST","path":"/books","body":{"book_name":"Dune"}}]`
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	(&batchHandler{dispatch: newRouter()}).ServeHTTP(httptest.NewRecorder(), req)
+
+	var n int64
+	if err := db.Model(&Book{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d books persisted after the client disconnected, want 0", n)
+	}
+}